@@ -0,0 +1,35 @@
+package prefixed_uuids
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// DeserializeAny deserializes an ID of any registered entity, returning
+// the entity and its UUIDs: a single pair for plain IDs, and the flattened
+// components for multi and list IDs. It lets tooling such as logging
+// middleware render IDs without knowing their type in advance. Secret
+// tokens and tenant scoped IDs are rejected like DeserializeWithEntity does.
+func (r *Registry) DeserializeAny(uuidStr string) (Entity, []EntityUUID, error) {
+	parsedEntity, payload, err := r.decodePayload(uuidStr)
+	if err != nil {
+		return NullEntity, nil, err
+	}
+	if r.isComposite(parsedEntity) {
+		pairs, err := r.DeserializeMultiEntities(parsedEntity, uuidStr)
+		if err != nil {
+			return NullEntity, nil, err
+		}
+		return parsedEntity, pairs, nil
+	}
+	if err := r.checkPlainEntity(parsedEntity); err != nil {
+		return NullEntity, nil, err
+	}
+
+	parsedUUID, err := uuid.FromBytes(payload)
+	if err != nil {
+		return NullEntity, nil, errors.Join(err, ErrInvalidUUIDFormat)
+	}
+	return parsedEntity, []EntityUUID{{parsedEntity, parsedUUID}}, nil
+}
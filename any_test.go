@@ -0,0 +1,52 @@
+package prefixed_uuids
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeserializeAny(t *testing.T) {
+	r := newListRegistry(t)
+	userID := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+	postID := uuid.MustParse("0195e37c-1a2b-7c3d-8e4f-5a6b7c8d9e0f")
+
+	entity, pairs, err := r.DeserializeAny(r.Serialize(User, userID))
+	assert.NoError(t, err)
+	assert.Equal(t, User, entity)
+	assert.Equal(t, []EntityUUID{{User, userID}}, pairs)
+
+	up, err := r.SerializeMulti(UserPost, EntityUUID{User, userID}, EntityUUID{Post, postID})
+	assert.NoError(t, err)
+	entity, pairs, err = r.DeserializeAny(up)
+	assert.NoError(t, err)
+	assert.Equal(t, UserPost, entity)
+	assert.Equal(t, []EntityUUID{{User, userID}, {Post, postID}}, pairs)
+
+	uuids := postUUIDs(3)
+	posts, err := r.SerializeMulti(PostSelection, postPairs(uuids)...)
+	assert.NoError(t, err)
+	entity, pairs, err = r.DeserializeAny(posts)
+	assert.NoError(t, err)
+	assert.Equal(t, PostSelection, entity)
+	assert.Equal(t, postPairs(uuids), pairs)
+
+	tests := []struct {
+		name  string
+		input string
+		err   error
+	}{
+		{"unknown prefix", "unknown.AZXje_k_dRiprKK-aEY8fg", ErrUnknownPrefix},
+		{"bad base64", "user.invalid!", ErrInvalidUUIDBadBase64},
+		{"short single", "user.AZXje_k_dRiprKK", ErrInvalidUUIDFormat},
+		{"short multi", "up.AZXje_k_dRiprKK-aEY8fg", ErrInvalidUUIDFormat},
+		{"no separator", "user", ErrInvalidPrefixedUUIDFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := r.DeserializeAny(tt.input)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
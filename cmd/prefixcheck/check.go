@@ -0,0 +1,368 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const libraryPath = "github.com/minhajuddin/prefixed_uuids"
+
+// registryMethods maps the checked Registry methods and default registry
+// functions to whether their first argument must be a multi entity.
+var registryMethods = map[string]bool{
+	"Serialize":        false,
+	"Deserialize":      false,
+	"SerializeMulti":   true,
+	"DeserializeMulti": true,
+}
+
+type diagnostic struct {
+	pos     token.Position
+	message string
+}
+
+func (d diagnostic) String() string {
+	return fmt.Sprintf("%s: %s", d.pos, d.message)
+}
+
+type entityConst struct {
+	obj   *types.Const
+	value string
+}
+
+// checker holds the state for a single type-checked package.
+type checker struct {
+	fset  *token.FileSet
+	pkg   *types.Package
+	info  *types.Info
+	files []*ast.File
+
+	consts     []entityConst
+	registered map[string]bool
+	multi      map[string]bool
+	unions     map[string]bool
+	diags      []diagnostic
+}
+
+// checkDir parses and type-checks every package in dir and returns the
+// diagnostics found, sorted by position.
+func checkDir(dir string, tests bool) ([]diagnostic, error) {
+	fset := token.NewFileSet()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	pkgs := make(map[string][]*ast.File)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || (!tests && strings.HasSuffix(name, "_test.go")) {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		pkgs[f.Name.Name] = append(pkgs[f.Name.Name], f)
+	}
+
+	names := make([]string, 0, len(pkgs))
+	for name := range pkgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var diags []diagnostic
+	for _, name := range names {
+		files := pkgs[name]
+		c := &checker{
+			fset:       fset,
+			files:      files,
+			registered: make(map[string]bool),
+			multi:      make(map[string]bool),
+			unions:     make(map[string]bool),
+			info: &types.Info{
+				Types:      make(map[ast.Expr]types.TypeAndValue),
+				Defs:       make(map[*ast.Ident]types.Object),
+				Uses:       make(map[*ast.Ident]types.Object),
+				Selections: make(map[*ast.SelectorExpr]*types.Selection),
+			},
+		}
+		conf := types.Config{
+			Importer: importer.ForCompiler(fset, "source", nil),
+			// Keep going on type errors so that partially broken packages
+			// still get checked; the compiler reports those errors anyway.
+			Error: func(error) {},
+		}
+		c.pkg, _ = conf.Check(name, fset, files, c.info)
+		c.run()
+		diags = append(diags, c.diags...)
+	}
+
+	sort.SliceStable(diags, func(i, j int) bool {
+		a, b := diags[i].pos, diags[j].pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return diags, nil
+}
+
+func (c *checker) reportf(pos token.Pos, format string, args ...any) {
+	c.diags = append(c.diags, diagnostic{c.fset.Position(pos), fmt.Sprintf(format, args...)})
+}
+
+func (c *checker) run() {
+	c.collectConsts()
+	c.checkDuplicates()
+	c.collectRegistrations()
+	if len(c.registered) == 0 {
+		// The registry is defined in another package, so there is nothing
+		// to compare entity usage against.
+		return
+	}
+	c.checkUnregistered()
+	c.checkCalls()
+}
+
+// isLibraryType reports whether t is the named type name from the library.
+func isLibraryType(t types.Type, name string) bool {
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	named, ok := t.(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	return obj.Name() == name && obj.Pkg() != nil && obj.Pkg().Path() == libraryPath
+}
+
+// isEntityType reports whether t is the library's Entity type. When the
+// library itself is checked the package path is the bare package name, so
+// types declared in the checked package are accepted too.
+func (c *checker) isEntityType(t types.Type) bool {
+	if isLibraryType(t, "Entity") {
+		return true
+	}
+	named, ok := t.(*types.Named)
+	return ok && named.Obj().Name() == "Entity" && named.Obj().Pkg() == c.pkg
+}
+
+func (c *checker) isLibraryStruct(t types.Type, name string) bool {
+	if isLibraryType(t, name) {
+		return true
+	}
+	named, ok := t.(*types.Named)
+	return ok && named.Obj().Name() == name && named.Obj().Pkg() == c.pkg
+}
+
+func (c *checker) collectConsts() {
+	for ident, obj := range c.info.Defs {
+		k, ok := obj.(*types.Const)
+		if !ok || ident.Name == "_" || !c.isEntityType(k.Type()) {
+			continue
+		}
+		c.consts = append(c.consts, entityConst{k, k.Val().ExactString()})
+	}
+	sort.Slice(c.consts, func(i, j int) bool { return c.consts[i].obj.Pos() < c.consts[j].obj.Pos() })
+}
+
+func (c *checker) checkDuplicates() {
+	seen := make(map[string]*types.Const)
+	for _, k := range c.consts {
+		if first, ok := seen[k.value]; ok {
+			c.reportf(k.obj.Pos(), "Entity constant %s has the same value (%s) as %s", k.obj.Name(), k.value, first.Name())
+			continue
+		}
+		seen[k.value] = k.obj
+	}
+}
+
+// entityField returns the expression used for the Entity field of a
+// PrefixInfo, MultiPrefixInfo, ListPrefixInfo, UnionInfo, EntityUUID or
+// EntityUUIDPtr literal.
+func entityField(lit *ast.CompositeLit) ast.Expr {
+	for i, elt := range lit.Elts {
+		if kv, ok := elt.(*ast.KeyValueExpr); ok {
+			if key, ok := kv.Key.(*ast.Ident); ok && key.Name == "Entity" {
+				return kv.Value
+			}
+			continue
+		}
+		if i == 0 {
+			return elt
+		}
+	}
+	return nil
+}
+
+// constValue returns the constant value of expr, if it has one.
+func (c *checker) constValue(expr ast.Expr) (string, bool) {
+	if expr == nil {
+		return "", false
+	}
+	tv, ok := c.info.Types[expr]
+	if !ok || tv.Value == nil || tv.Value.Kind() != constant.Int {
+		return "", false
+	}
+	return tv.Value.ExactString(), true
+}
+
+func (c *checker) collectRegistrations() {
+	for _, f := range c.files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			lit, ok := n.(*ast.CompositeLit)
+			if !ok {
+				return true
+			}
+			tv, ok := c.info.Types[lit]
+			if !ok {
+				return true
+			}
+			isMulti := c.isLibraryStruct(tv.Type, "MultiPrefixInfo") || c.isLibraryStruct(tv.Type, "ListPrefixInfo")
+			isUnion := c.isLibraryStruct(tv.Type, "UnionInfo")
+			if !isMulti && !isUnion && !c.isLibraryStruct(tv.Type, "PrefixInfo") {
+				return true
+			}
+			if v, ok := c.constValue(entityField(lit)); ok {
+				c.registered[v] = true
+				c.multi[v] = c.multi[v] || isMulti
+				c.unions[v] = c.unions[v] || isUnion
+			}
+			return true
+		})
+	}
+}
+
+func (c *checker) checkUnregistered() {
+	for _, k := range c.consts {
+		if !c.registered[k.value] {
+			c.reportf(k.obj.Pos(), "Entity constant %s is never registered in a PrefixInfo, MultiPrefixInfo or ListPrefixInfo", k.obj.Name())
+		}
+	}
+}
+
+// entityName returns a readable name for an entity expression.
+func (c *checker) entityName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.SelectorExpr:
+		return e.Sel.Name
+	}
+	v, _ := c.constValue(expr)
+	return v
+}
+
+func (c *checker) checkCalls() {
+	for _, f := range c.files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || len(call.Args) == 0 {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			wantMulti, ok := registryMethods[sel.Sel.Name]
+			if !ok {
+				return true
+			}
+			if !c.isRegistryCall(sel) {
+				return true
+			}
+			c.checkCall(sel.Sel.Name, call, wantMulti)
+			return true
+		})
+	}
+}
+
+// isRegistryCall reports whether sel is a Registry method or one of the
+// package-level functions using the default registry.
+func (c *checker) isRegistryCall(sel *ast.SelectorExpr) bool {
+	if selection, ok := c.info.Selections[sel]; ok {
+		return selection.Kind() == types.MethodVal && c.isLibraryStruct(selection.Recv(), "Registry")
+	}
+	fn, ok := c.info.Uses[sel.Sel].(*types.Func)
+	return ok && fn.Pkg() != nil && fn.Pkg().Path() == libraryPath
+}
+
+func (c *checker) checkCall(method string, call *ast.CallExpr, wantMulti bool) {
+	entity := call.Args[0]
+	v, ok := c.constValue(entity)
+	if !ok {
+		return
+	}
+	name := c.entityName(entity)
+	switch {
+	case !c.registered[v]:
+		c.reportf(entity.Pos(), "%s called with entity %s which is not registered", method, name)
+		return
+	case c.unions[v]:
+		c.reportf(entity.Pos(), "%s called with union entity %s which has no prefix", method, name)
+		return
+	case wantMulti && !c.multi[v]:
+		c.reportf(entity.Pos(), "%s called with entity %s which is not a multi type", method, name)
+		return
+	case !wantMulti && c.multi[v]:
+		c.reportf(entity.Pos(), "%s called with multi entity %s, use %sMulti", method, name, method)
+		return
+	}
+
+	if wantMulti {
+		for _, arg := range call.Args[1:] {
+			lit, ok := arg.(*ast.CompositeLit)
+			if !ok {
+				continue
+			}
+			component := entityField(lit)
+			if cv, ok := c.constValue(component); ok && !c.registered[cv] {
+				c.reportf(component.Pos(), "%s component entity %s is not registered", method, c.entityName(component))
+			}
+		}
+		return
+	}
+
+	if method == "Serialize" && len(call.Args) == 2 {
+		c.checkArgumentName(call.Args[1], name)
+	}
+}
+
+// checkArgumentName flags calls like Serialize(Post, userID), where the
+// UUID argument is named after a different registered entity.
+func (c *checker) checkArgumentName(arg ast.Expr, entityName string) {
+	ident, ok := arg.(*ast.Ident)
+	if !ok {
+		return
+	}
+	base := strings.ToLower(ident.Name)
+	for _, suffix := range []string{"_uuid", "uuid", "_id", "id"} {
+		if trimmed, ok := strings.CutSuffix(base, suffix); ok && trimmed != "" {
+			base = trimmed
+			break
+		}
+	}
+	if base == strings.ToLower(entityName) {
+		return
+	}
+	for _, k := range c.consts {
+		if strings.ToLower(k.obj.Name()) == base && c.registered[k.value] {
+			c.reportf(arg.Pos(), "Serialize called with entity %s but argument %s looks like a %s", entityName, ident.Name, k.obj.Name())
+			return
+		}
+	}
+}
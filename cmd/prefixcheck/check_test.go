@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckDir(t *testing.T) {
+	diags, err := checkDir(filepath.Join("testdata", "src", "app"), false)
+	assert.NoError(t, err)
+
+	var got []string
+	for _, d := range diags {
+		got = append(got, fmt.Sprintf("%s:%d: %s", filepath.Base(d.pos.Filename), d.pos.Line, d.message))
+	}
+	assert.Equal(t, []string{
+		"app.go:11: Entity constant Comment is never registered in a PrefixInfo, MultiPrefixInfo or ListPrefixInfo",
+		"app.go:12: Entity constant Photo has the same value (3) as Comment",
+		"app.go:12: Entity constant Photo is never registered in a PrefixInfo, MultiPrefixInfo or ListPrefixInfo",
+		"app.go:40: Serialize called with entity Post but argument userID looks like a User",
+		"app.go:41: Serialize called with entity Comment which is not registered",
+		"app.go:42: Deserialize called with multi entity UserPost, use DeserializeMulti",
+		"app.go:43: SerializeMulti called with entity User which is not a multi type",
+		"app.go:46: SerializeMulti component entity Comment is not registered",
+		"app.go:48: Serialize called with entity Comment which is not registered",
+		"app.go:49: Serialize called with union entity Content which has no prefix",
+	}, got)
+}
+
+func TestCheckDirWithoutRegistry(t *testing.T) {
+	// The library's own sources declare no Entity constants or registry,
+	// so nothing is reported.
+	diags, err := checkDir(filepath.Join("..", ".."), false)
+	assert.NoError(t, err)
+	assert.Empty(t, diags)
+}
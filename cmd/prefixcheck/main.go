@@ -0,0 +1,55 @@
+// Command prefixcheck statically checks how a package uses Entity constants
+// with a prefixed_uuids Registry.
+//
+// Usage:
+//
+//	prefixcheck [-tests] [dir ...]
+//
+// It reports, in the same file:line:col format as go vet:
+//
+//   - Entity constants which are never registered in a PrefixInfo,
+//     MultiPrefixInfo or ListPrefixInfo literal
+//   - Entity constants which share a value with another constant
+//   - Serialize, Deserialize, SerializeMulti and DeserializeMulti calls with
+//     constant entities which are not registered, or are of the wrong kind,
+//     both as Registry methods and as default registry functions
+//   - Serialize calls whose UUID argument is named after another entity,
+//     e.g. Serialize(Post, userID)
+//
+// The registry checks only run for packages which declare their registry
+// definition; the exit status is 1 when any diagnostic is reported.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	tests := flag.Bool("tests", false, "also check _test.go files")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: prefixcheck [-tests] [dir ...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	dirs := flag.Args()
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+
+	exit := 0
+	for _, dir := range dirs {
+		diags, err := checkDir(dir, *tests)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "prefixcheck: %v\n", err)
+			os.Exit(2)
+		}
+		for _, d := range diags {
+			fmt.Fprintln(os.Stderr, d)
+			exit = 1
+		}
+	}
+	os.Exit(exit)
+}
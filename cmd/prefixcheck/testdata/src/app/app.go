@@ -0,0 +1,50 @@
+package app
+
+import (
+	"github.com/google/uuid"
+	prefixed_uuids "github.com/minhajuddin/prefixed_uuids"
+)
+
+const (
+	User     prefixed_uuids.Entity = 1
+	Post     prefixed_uuids.Entity = 2
+	Comment  prefixed_uuids.Entity = 3
+	Photo    prefixed_uuids.Entity = 3
+	UserPost prefixed_uuids.Entity = 10
+	Content  prefixed_uuids.Entity = 30
+)
+
+func newRegistry() *prefixed_uuids.Registry {
+	r, err := prefixed_uuids.NewRegistry2(
+		[]prefixed_uuids.PrefixInfo{
+			{User, "user"},
+			{Entity: Post, Prefix: "post"},
+		},
+		[]prefixed_uuids.MultiPrefixInfo{
+			{UserPost, "up", []prefixed_uuids.Entity{User, Post}},
+		},
+	)
+	if err != nil {
+		panic(err)
+	}
+	r, err = r.WithUnions(prefixed_uuids.UnionInfo{Entity: Content, Entities: []prefixed_uuids.Entity{User, Post}})
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+func use(userID, postID uuid.UUID) {
+	r := newRegistry()
+	_ = r.Serialize(User, userID)
+	_ = r.Serialize(Post, userID)
+	_ = r.Serialize(Comment, postID)
+	_, _ = r.Deserialize(UserPost, "up.xxx")
+	_, _ = r.SerializeMulti(User)
+	_, _ = r.SerializeMulti(UserPost,
+		prefixed_uuids.EntityUUID{User, userID},
+		prefixed_uuids.EntityUUID{Comment, postID},
+	)
+	_ = prefixed_uuids.Serialize(Comment, postID)
+	_ = r.Serialize(Content, postID)
+}
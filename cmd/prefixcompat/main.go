@@ -0,0 +1,64 @@
+// Command prefixcompat compares two JSON encoded registry definitions and
+// reports changes which would affect IDs that have already been issued.
+//
+// Usage:
+//
+//	prefixcompat old.json new.json
+//
+// It exits with status 1 when a breaking change is found and 2 on usage or
+// input errors, so it can be used to gate merges in CI.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	prefixed_uuids "github.com/minhajuddin/prefixed_uuids"
+)
+
+func main() {
+	quiet := flag.Bool("q", false, "only print breaking changes")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: prefixcompat [-q] old.json new.json\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	exit, err := compare(flag.Arg(0), flag.Arg(1), *quiet, os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "prefixcompat: %v\n", err)
+		os.Exit(2)
+	}
+	os.Exit(exit)
+}
+
+// compare prints the changes between the definitions at oldPath and
+// newPath to w and returns the exit status, 1 if any change is breaking.
+func compare(oldPath, newPath string, quiet bool, w io.Writer) (int, error) {
+	oldDef, err := prefixed_uuids.LoadDefinition(oldPath)
+	if err != nil {
+		return 0, err
+	}
+	newDef, err := prefixed_uuids.LoadDefinition(newPath)
+	if err != nil {
+		return 0, err
+	}
+
+	changes := prefixed_uuids.CheckCompatibility(oldDef, newDef)
+	for _, c := range changes {
+		if quiet && c.Severity != prefixed_uuids.ChangeBreaking {
+			continue
+		}
+		fmt.Fprintln(w, c)
+	}
+	if prefixed_uuids.HasBreakingChanges(changes) {
+		return 1, nil
+	}
+	return 0, nil
+}
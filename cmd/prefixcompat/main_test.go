@@ -0,0 +1,35 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompare(t *testing.T) {
+	v1 := filepath.Join("testdata", "v1.json")
+
+	var out strings.Builder
+	exit, err := compare(v1, filepath.Join("testdata", "v2_breaking.json"), false, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, exit)
+	assert.Contains(t, out.String(), "breaking:")
+
+	out.Reset()
+	exit, err = compare(v1, filepath.Join("testdata", "v2_safe.json"), false, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, exit)
+	assert.Equal(t, "safe: new entity 3 with prefix \"comment\"\n", out.String())
+
+	// Quiet mode only prints breaking changes.
+	out.Reset()
+	exit, err = compare(v1, filepath.Join("testdata", "v2_safe.json"), true, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, exit)
+	assert.Empty(t, out.String())
+
+	_, err = compare(v1, filepath.Join("testdata", "missing.json"), false, &out)
+	assert.Error(t, err)
+}
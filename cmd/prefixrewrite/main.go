@@ -0,0 +1,106 @@
+// Command prefixrewrite is a filter which replaces raw UUIDs in log lines
+// with prefixed IDs, or prefixed IDs with raw UUIDs.
+//
+// Usage:
+//
+//	prefixrewrite -def registry.json -rule user_id=user -rule post_id=post < in.log
+//	prefixrewrite -def registry.json -reverse < in.log
+//
+// Rules map a field to a prefix of the JSON encoded registry definition.
+// Fields are matched in text (user_id=<uuid>) and JSON ("user_id":
+// "<uuid>") log lines. With -reverse, every prefixed ID is replaced with its
+// raw UUIDs, so logs can be grepped for UUIDs. It exits with status 2 on
+// usage or input errors.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	prefixed_uuids "github.com/minhajuddin/prefixed_uuids"
+)
+
+// rulesFlag collects repeated -rule flags.
+type rulesFlag []string
+
+func (f *rulesFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *rulesFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func main() {
+	defPath := flag.String("def", "", "JSON encoded registry definition")
+	reverse := flag.Bool("reverse", false, "replace prefixed IDs with raw UUIDs")
+	var rules rulesFlag
+	flag.Var(&rules, "rule", "field=prefix rule, may be repeated")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: prefixrewrite -def registry.json (-rule field=prefix ... | -reverse) < in > out\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *defPath == "" || flag.NArg() != 0 || (len(rules) == 0) != *reverse {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	def, err := prefixed_uuids.LoadDefinition(*defPath)
+	if err != nil {
+		fail(err)
+	}
+	registry, err := prefixed_uuids.NewRegistryFromDefinition(def)
+	if err != nil {
+		fail(err)
+	}
+	rewriteRules, err := parseRules(registry, rules)
+	if err != nil {
+		fail(err)
+	}
+	rewriter, err := prefixed_uuids.NewRewriter(registry, rewriteRules...)
+	if err != nil {
+		fail(err)
+	}
+
+	if *reverse {
+		err = rewriter.ReverseStream(os.Stdout, os.Stdin)
+	} else {
+		err = rewriter.RewriteStream(os.Stdout, os.Stdin)
+	}
+	if err != nil {
+		fail(err)
+	}
+}
+
+// parseRules parses field=prefix rules, looking prefixes up in registry.
+// Any registered prefix can be used, including aliases and environment
+// prefixes.
+func parseRules(registry *prefixed_uuids.Registry, rules []string) ([]prefixed_uuids.RewriteRule, error) {
+	patterns := registry.Patterns()
+	entities := make(map[string]prefixed_uuids.Entity, len(patterns))
+	for _, p := range patterns {
+		entities[p.Prefix] = p.Entity
+	}
+	parsed := make([]prefixed_uuids.RewriteRule, 0, len(rules))
+	for _, rule := range rules {
+		field, prefix, ok := strings.Cut(rule, "=")
+		if !ok || field == "" {
+			return nil, fmt.Errorf("invalid rule %q, expected field=prefix", rule)
+		}
+		entity, ok := entities[prefix]
+		if !ok {
+			return nil, fmt.Errorf("rule %q: prefix %q is not defined", rule, prefix)
+		}
+		parsed = append(parsed, prefixed_uuids.RewriteRule{Field: field, Entity: entity})
+	}
+	return parsed, nil
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "prefixrewrite: %v\n", err)
+	os.Exit(2)
+}
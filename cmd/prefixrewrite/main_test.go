@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	prefixed_uuids "github.com/minhajuddin/prefixed_uuids"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRules(t *testing.T) {
+	registry, err := prefixed_uuids.NewRegistryFromDefinition(prefixed_uuids.Definition{
+		Prefixes: []prefixed_uuids.PrefixInfo{
+			{Entity: 1, Prefix: "usr"},
+			{Entity: 1, Prefix: "user"},
+			{Entity: 2, Prefix: "pk"},
+		},
+		Environments: []prefixed_uuids.Entity{2},
+	})
+	assert.NoError(t, err)
+
+	rules, err := parseRules(registry, []string{"user_id=user", "legacy_id=usr", "key=pk_live", "test_key=pk_test"})
+	assert.NoError(t, err)
+	assert.Equal(t, []prefixed_uuids.RewriteRule{
+		{Field: "user_id", Entity: 1},
+		{Field: "legacy_id", Entity: 1},
+		{Field: "key", Entity: 2},
+		{Field: "test_key", Entity: 2},
+	}, rules)
+
+	for rule, expectedError := range map[string]string{
+		"user_id":      `invalid rule "user_id"`,
+		"=user":        `invalid rule "=user"`,
+		"post_id=post": `prefix "post" is not defined`,
+	} {
+		_, err := parseRules(registry, []string{rule})
+		assert.ErrorContains(t, err, expectedError, rule)
+	}
+}
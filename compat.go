@@ -0,0 +1,317 @@
+package prefixed_uuids
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// ChangeSeverity classifies how a registry change affects IDs which have
+// already been handed out.
+type ChangeSeverity int
+
+const (
+	// ChangeSafe changes only add new IDs, e.g. a new entity.
+	ChangeSafe ChangeSeverity = iota
+	// ChangeRisky changes keep existing IDs parseable but alter what is
+	// accepted or produced, e.g. a new alias for an existing entity.
+	ChangeRisky
+	// ChangeBreaking changes make existing IDs fail to parse or parse as
+	// something else.
+	ChangeBreaking
+)
+
+func (s ChangeSeverity) String() string {
+	switch s {
+	case ChangeSafe:
+		return "safe"
+	case ChangeRisky:
+		return "risky"
+	case ChangeBreaking:
+		return "breaking"
+	default:
+		return fmt.Sprintf("ChangeSeverity(%d)", int(s))
+	}
+}
+
+// Change is a single difference between two registry definitions.
+type Change struct {
+	Severity ChangeSeverity
+	Entity   Entity
+	Prefix   string
+	Message  string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s", c.Severity, c.Message)
+}
+
+type definitionIndex struct {
+	canonical map[Entity]string
+	accepted  map[string]Entity
+	multi     map[Entity][]Entity
+	lists     map[Entity]ListPrefixInfo
+}
+
+func indexDefinition(def Definition) definitionIndex {
+	idx := definitionIndex{
+		canonical: make(map[Entity]string),
+		accepted:  make(map[string]Entity),
+		multi:     make(map[Entity][]Entity),
+		lists:     make(map[Entity]ListPrefixInfo),
+	}
+	for _, p := range def.Prefixes {
+		idx.canonical[p.Entity] = p.Prefix
+		idx.accepted[p.Prefix] = p.Entity
+	}
+	for _, p := range def.Aliases {
+		idx.accepted[p.Prefix] = p.Entity
+	}
+	for _, m := range def.Multi {
+		idx.canonical[m.Entity] = m.Prefix
+		idx.accepted[m.Prefix] = m.Entity
+		idx.multi[m.Entity] = m.Entities
+	}
+	for _, l := range def.Lists {
+		idx.canonical[l.Entity] = l.Prefix
+		idx.accepted[l.Prefix] = l.Entity
+		idx.lists[l.Entity] = l
+	}
+	for _, entity := range def.Environments {
+		for _, env := range environments {
+			idx.accepted[envPrefix(idx.canonical[entity], env)] = entity
+		}
+	}
+	return idx
+}
+
+// CheckCompatibility compares two registry definitions and returns the
+// changes needed to go from oldDef to newDef. Changes are ordered with the
+// most severe first.
+func CheckCompatibility(oldDef, newDef Definition) []Change {
+	oldIdx, newIdx := indexDefinition(oldDef), indexDefinition(newDef)
+	var changes []Change
+
+	if oldDef.Separator != newDef.Separator {
+		changes = append(changes, Change{
+			Severity: ChangeBreaking,
+			Message:  fmt.Sprintf("separator changed from %q to %q", oldDef.Separator, newDef.Separator),
+		})
+	}
+
+	if oldDef.Encoding != newDef.Encoding {
+		changes = append(changes, Change{
+			Severity: ChangeBreaking,
+			Message:  fmt.Sprintf("encoding changed from %q to %q", oldDef.Encoding, newDef.Encoding),
+		})
+	}
+
+	if oldDef.URNNamespace != "" && !strings.EqualFold(oldDef.URNNamespace, newDef.URNNamespace) {
+		changes = append(changes, Change{
+			Severity: ChangeBreaking,
+			Message:  fmt.Sprintf("urn namespace changed from %q to %q", oldDef.URNNamespace, newDef.URNNamespace),
+		})
+	}
+
+	// Compressed and uncompressed payloads are both always accepted, so only
+	// readers running an older version of the library are affected.
+	if oldDef.Compression != newDef.Compression {
+		changes = append(changes, Change{
+			Severity: ChangeRisky,
+			Message:  fmt.Sprintf("compression changed from %q to %q", oldDef.Compression, newDef.Compression),
+		})
+	}
+
+	if oldDef.SecretChecksum != newDef.SecretChecksum && len(oldDef.Secrets) > 0 {
+		changes = append(changes, Change{
+			Severity: ChangeBreaking,
+			Message:  fmt.Sprintf("secret checksum changed from %q to %q", oldDef.SecretChecksum, newDef.SecretChecksum),
+		})
+	}
+
+	for prefix, entity := range oldIdx.accepted {
+		newEntity, ok := newIdx.accepted[prefix]
+		switch {
+		case !ok && oldIdx.canonical[entity] == prefix && newIdx.canonical[entity] != "":
+			changes = append(changes, Change{ChangeBreaking, entity, prefix,
+				fmt.Sprintf("prefix %q of entity %d renamed to %q", prefix, entity, newIdx.canonical[entity])})
+		case !ok:
+			changes = append(changes, Change{ChangeBreaking, entity, prefix,
+				fmt.Sprintf("prefix %q of entity %d removed", prefix, entity)})
+		case newEntity != entity:
+			changes = append(changes, Change{ChangeBreaking, entity, prefix,
+				fmt.Sprintf("prefix %q renumbered from entity %d to %d", prefix, entity, newEntity)})
+		default:
+			changes = append(changes, checkMultiCompatibility(oldIdx, newIdx, entity, prefix)...)
+		}
+	}
+
+	changes = append(changes, checkNamespaceCompatibility(oldDef, newDef)...)
+	changes = append(changes, checkUnionCompatibility(oldDef, newDef)...)
+	changes = append(changes, checkEntitySetCompatibility(oldDef.TenantScoped, newDef.TenantScoped, oldIdx, "tenant scoped")...)
+	changes = append(changes, checkEntitySetCompatibility(oldDef.Secrets, newDef.Secrets, oldIdx, "secret")...)
+
+	for entity, prefix := range oldIdx.canonical {
+		newPrefix, ok := newIdx.canonical[entity]
+		if ok && newPrefix != prefix && newIdx.accepted[prefix] == entity {
+			changes = append(changes, Change{ChangeRisky, entity, newPrefix,
+				fmt.Sprintf("entity %d now serializes with prefix %q instead of %q", entity, newPrefix, prefix)})
+		}
+	}
+
+	for prefix, entity := range newIdx.accepted {
+		if _, ok := oldIdx.accepted[prefix]; ok {
+			continue
+		}
+		if _, existed := oldIdx.canonical[entity]; !existed {
+			changes = append(changes, Change{ChangeSafe, entity, prefix,
+				fmt.Sprintf("new entity %d with prefix %q", entity, prefix)})
+			continue
+		}
+		if newIdx.canonical[entity] == prefix {
+			// Already reported as a rename above.
+			continue
+		}
+		changes = append(changes, Change{ChangeRisky, entity, prefix,
+			fmt.Sprintf("new alias %q for entity %d", prefix, entity)})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Severity != changes[j].Severity {
+			return changes[i].Severity > changes[j].Severity
+		}
+		return changes[i].Message < changes[j].Message
+	})
+	return changes
+}
+
+func checkMultiCompatibility(oldIdx, newIdx definitionIndex, entity Entity, prefix string) []Change {
+	oldComponents, wasMulti := oldIdx.multi[entity]
+	newComponents, isMulti := newIdx.multi[entity]
+	oldList, wasList := oldIdx.lists[entity]
+	newList, isList := newIdx.lists[entity]
+	switch {
+	case wasMulti && !isMulti:
+		return []Change{{ChangeBreaking, entity, prefix,
+			fmt.Sprintf("entity %d (%q) is no longer a multi type", entity, prefix)}}
+	case !wasMulti && isMulti:
+		return []Change{{ChangeBreaking, entity, prefix,
+			fmt.Sprintf("entity %d (%q) became a multi type", entity, prefix)}}
+	case wasMulti && !slices.Equal(oldComponents, newComponents):
+		return []Change{{ChangeBreaking, entity, prefix,
+			fmt.Sprintf("multi type %d (%q) components changed from [%s] to [%s]", entity, prefix, formatComponents(oldComponents), formatComponents(newComponents))}}
+	case wasList != isList:
+		return []Change{{ChangeBreaking, entity, prefix,
+			fmt.Sprintf("entity %d (%q) changed between list and non-list type", entity, prefix)}}
+	case wasList && oldList.Component != newList.Component:
+		return []Change{{ChangeBreaking, entity, prefix,
+			fmt.Sprintf("list type %d (%q) component changed from %d to %d", entity, prefix, oldList.Component, newList.Component)}}
+	case wasList && (newList.Min > oldList.Min || newList.Max < oldList.Max):
+		return []Change{{ChangeBreaking, entity, prefix,
+			fmt.Sprintf("list type %d (%q) bounds narrowed from %d..%d to %d..%d", entity, prefix, oldList.Min, oldList.Max, newList.Min, newList.Max)}}
+	case wasList && (newList.Min != oldList.Min || newList.Max != oldList.Max):
+		return []Change{{ChangeSafe, entity, prefix,
+			fmt.Sprintf("list type %d (%q) bounds widened from %d..%d to %d..%d", entity, prefix, oldList.Min, oldList.Max, newList.Min, newList.Max)}}
+	}
+	return nil
+}
+
+// checkNamespaceCompatibility reports changes to derivation namespaces. They
+// don't affect parsing, but re-deriving an ID would produce a different UUID
+// and break idempotent creation.
+func checkNamespaceCompatibility(oldDef, newDef Definition) []Change {
+	newNamespaces := make(map[Entity]uuid.UUID, len(newDef.Namespaces))
+	for _, n := range newDef.Namespaces {
+		newNamespaces[n.Entity] = n.Namespace
+	}
+	var changes []Change
+	if len(oldDef.Namespaces) > 0 && len(newDef.Namespaces) > 0 && oldDef.Derivation != newDef.Derivation {
+		changes = append(changes, Change{
+			Severity: ChangeBreaking,
+			Message:  fmt.Sprintf("derivation changed from %q to %q", oldDef.Derivation, newDef.Derivation),
+		})
+	}
+	for _, n := range oldDef.Namespaces {
+		namespace, ok := newNamespaces[n.Entity]
+		switch {
+		case !ok:
+			changes = append(changes, Change{ChangeBreaking, n.Entity, "",
+				fmt.Sprintf("namespace of entity %d removed", n.Entity)})
+		case namespace != n.Namespace:
+			changes = append(changes, Change{ChangeBreaking, n.Entity, "",
+				fmt.Sprintf("namespace of entity %d changed from %s to %s", n.Entity, n.Namespace, namespace)})
+		}
+	}
+	return changes
+}
+
+// checkUnionCompatibility reports changes to unions. Union components are
+// tagged with the index of the stored entity, so only appending entities is
+// safe.
+func checkUnionCompatibility(oldDef, newDef Definition) []Change {
+	oldUnions := make(map[Entity][]Entity, len(oldDef.Unions))
+	for _, u := range oldDef.Unions {
+		oldUnions[u.Entity] = u.Entities
+	}
+	newUnions := make(map[Entity][]Entity, len(newDef.Unions))
+	for _, u := range newDef.Unions {
+		newUnions[u.Entity] = u.Entities
+	}
+
+	var changes []Change
+	for _, u := range oldDef.Unions {
+		entities, ok := newUnions[u.Entity]
+		switch {
+		case !ok:
+			changes = append(changes, Change{ChangeBreaking, u.Entity, "",
+				fmt.Sprintf("union %d removed", u.Entity)})
+		case len(entities) < len(u.Entities) || !slices.Equal(entities[:len(u.Entities)], u.Entities):
+			changes = append(changes, Change{ChangeBreaking, u.Entity, "",
+				fmt.Sprintf("union %d entities changed from [%s] to [%s]", u.Entity, formatComponents(u.Entities), formatComponents(entities))})
+		case len(entities) > len(u.Entities):
+			changes = append(changes, Change{ChangeSafe, u.Entity, "",
+				fmt.Sprintf("union %d entities extended from [%s] to [%s]", u.Entity, formatComponents(u.Entities), formatComponents(entities))})
+		}
+	}
+	for _, u := range newDef.Unions {
+		if _, ok := oldUnions[u.Entity]; !ok {
+			changes = append(changes, Change{ChangeSafe, u.Entity, "",
+				fmt.Sprintf("new union %d with entities [%s]", u.Entity, formatComponents(u.Entities))})
+		}
+	}
+	return changes
+}
+
+// checkEntitySetCompatibility reports entities which joined or left a set
+// of entities whose IDs have a different payload, e.g. the tenant scoped
+// entities. Either way existing IDs of the entity no longer parse. New
+// entities may join from the start.
+func checkEntitySetCompatibility(oldSet, newSet []Entity, oldIdx definitionIndex, what string) []Change {
+	var changes []Change
+	for _, entity := range oldSet {
+		if !slices.Contains(newSet, entity) {
+			changes = append(changes, Change{ChangeBreaking, entity, "",
+				fmt.Sprintf("entity %d is no longer %s", entity, what)})
+		}
+	}
+	for _, entity := range newSet {
+		if _, existed := oldIdx.canonical[entity]; existed && !slices.Contains(oldSet, entity) {
+			changes = append(changes, Change{ChangeBreaking, entity, "",
+				fmt.Sprintf("entity %d became %s", entity, what)})
+		}
+	}
+	return changes
+}
+
+// HasBreakingChanges reports whether any of the changes is breaking.
+func HasBreakingChanges(changes []Change) bool {
+	for _, c := range changes {
+		if c.Severity == ChangeBreaking {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,189 @@
+package prefixed_uuids
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func mustRegistry(t *testing.T, prefixes []PrefixInfo, multiPrefixes []MultiPrefixInfo) *Registry {
+	t.Helper()
+	r, err := NewRegistry2(prefixes, multiPrefixes)
+	assert.NoError(t, err)
+	return r
+}
+
+func changeMessages(changes []Change) []string {
+	var out []string
+	for _, c := range changes {
+		out = append(out, c.String())
+	}
+	return out
+}
+
+func TestDefinition(t *testing.T) {
+	r := mustRegistry(t,
+		[]PrefixInfo{{Post, "post"}, {User, "usr"}, {User, "user"}},
+		[]MultiPrefixInfo{{UserPost, "up", []Entity{User, Post}}},
+	)
+	def := r.Definition()
+	assert.Equal(t, ".", def.Separator)
+	assert.Equal(t, EncodingBase64URL, def.Encoding)
+	assert.Equal(t, []PrefixInfo{{User, "user"}, {Post, "post"}}, def.Prefixes)
+	assert.Equal(t, []PrefixInfo{{User, "usr"}}, def.Aliases)
+	assert.Equal(t, []MultiPrefixInfo{{UserPost, "up", []Entity{User, Post}}}, def.Multi)
+
+	parsed, err := ReadDefinition(strings.NewReader(`{"prefixes":[{"entity":1,"prefix":"user"}]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, Definition{Separator: ".", Encoding: EncodingBase64URL, Prefixes: []PrefixInfo{{User, "user"}}}, parsed)
+
+	_, err = ReadDefinition(strings.NewReader(`{`))
+	assert.Error(t, err)
+}
+
+func TestNewRegistryFromDefinition(t *testing.T) {
+	withAliases := mustRegistry(t,
+		[]PrefixInfo{{Post, "post"}, {User, "usr"}, {User, "user"}},
+		[]MultiPrefixInfo{{UserPost, "up", []Entity{User, Post}}},
+	)
+	lists, err := mustRegistry(t, []PrefixInfo{{User, "user"}}, nil).
+		WithLists(ListPrefixInfo{PostSelection, "users", User, 1, 3})
+	assert.NoError(t, err)
+	underscore, err := mustRegistry(t, []PrefixInfo{{User, "user"}, {Post, "post"}}, nil).WithSeparator("_")
+	assert.NoError(t, err)
+	typeID, err := mustRegistry(t, []PrefixInfo{{User, "user"}}, nil).WithTypeID()
+	assert.NoError(t, err)
+	derived, err := mustRegistry(t, []PrefixInfo{{User, "user"}}, nil).WithNamespace(User, uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8"))
+	assert.NoError(t, err)
+	derived, err = derived.WithDerivation(DeriveSHA256)
+	assert.NoError(t, err)
+	urn, err := mustRegistry(t, []PrefixInfo{{User, "user"}}, nil).WithURNNamespace("example")
+	assert.NoError(t, err)
+
+	registries := map[string]*Registry{
+		"aliases":    withAliases,
+		"multi":      prefixer,
+		"compressed": newCompressedRegistry(t),
+		"lists":      lists,
+		"secrets":    newChecksumRegistry(t),
+		"separator":  underscore,
+		"typeid":     typeID,
+		"derivation": derived,
+		"urn":        urn,
+	}
+	for name, r := range registries {
+		t.Run(name, func(t *testing.T) {
+			def := r.Definition()
+			rebuilt, err := NewRegistryFromDefinition(def)
+			assert.NoError(t, err)
+			assert.Equal(t, def, rebuilt.Definition())
+			assert.Equal(t, r.Fingerprint(), rebuilt.Fingerprint())
+		})
+	}
+
+	// IDs serialized by the original registry parse with the rebuilt one.
+	rebuilt, err := NewRegistryFromDefinition(withAliases.Definition())
+	assert.NoError(t, err)
+	u := uuid.New()
+	assert.Equal(t, withAliases.Serialize(User, u), rebuilt.Serialize(User, u))
+
+	_, err = NewRegistryFromDefinition(newTenantRegistry(t).Definition())
+	assert.ErrorContains(t, err, "tenant scoped entities [2] need a key")
+	_, err = NewRegistryFromDefinition(Definition{Prefixes: []PrefixInfo{{User, "user"}}, Encoding: "base32"})
+	assert.ErrorContains(t, err, `unknown encoding "base32"`)
+	_, err = NewRegistryFromDefinition(Definition{
+		Prefixes: []PrefixInfo{{User, "user"}},
+		Multi:    []MultiPrefixInfo{{UserPost, "up", []Entity{User, Post}}},
+	})
+	assert.Error(t, err)
+}
+
+func TestCheckCompatibility(t *testing.T) {
+	base := mustRegistry(t,
+		[]PrefixInfo{{User, "user"}, {Post, "post"}, {Comment, "comment"}},
+		[]MultiPrefixInfo{{UserPost, "up", []Entity{User, Post}}},
+	).Definition()
+
+	t.Run("identical", func(t *testing.T) {
+		assert.Empty(t, CheckCompatibility(base, base))
+	})
+
+	t.Run("new entity is safe", func(t *testing.T) {
+		next := mustRegistry(t,
+			[]PrefixInfo{{User, "user"}, {Post, "post"}, {Comment, "comment"}, {SessionID, "sid"}},
+			[]MultiPrefixInfo{{UserPost, "up", []Entity{User, Post}}},
+		).Definition()
+		changes := CheckCompatibility(base, next)
+		assert.Equal(t, []string{`safe: new entity 7 with prefix "sid"`}, changeMessages(changes))
+		assert.False(t, HasBreakingChanges(changes))
+	})
+
+	t.Run("new alias is risky", func(t *testing.T) {
+		next := mustRegistry(t,
+			[]PrefixInfo{{User, "usr"}, {User, "user"}, {Post, "post"}, {Comment, "comment"}},
+			[]MultiPrefixInfo{{UserPost, "up", []Entity{User, Post}}},
+		).Definition()
+		changes := CheckCompatibility(base, next)
+		assert.Equal(t, []string{`risky: new alias "usr" for entity 1`}, changeMessages(changes))
+		assert.False(t, HasBreakingChanges(changes))
+	})
+
+	t.Run("rename keeping old prefix as alias is risky", func(t *testing.T) {
+		next := mustRegistry(t,
+			[]PrefixInfo{{User, "user"}, {User, "usr"}, {Post, "post"}, {Comment, "comment"}},
+			[]MultiPrefixInfo{{UserPost, "up", []Entity{User, Post}}},
+		).Definition()
+		changes := CheckCompatibility(base, next)
+		assert.Equal(t, []string{`risky: entity 1 now serializes with prefix "usr" instead of "user"`}, changeMessages(changes))
+	})
+
+	t.Run("renamed prefix is breaking", func(t *testing.T) {
+		next := mustRegistry(t,
+			[]PrefixInfo{{User, "usr"}, {Post, "post"}, {Comment, "comment"}},
+			[]MultiPrefixInfo{{UserPost, "up", []Entity{User, Post}}},
+		).Definition()
+		changes := CheckCompatibility(base, next)
+		assert.Equal(t, []string{`breaking: prefix "user" of entity 1 renamed to "usr"`}, changeMessages(changes))
+		assert.True(t, HasBreakingChanges(changes))
+	})
+
+	t.Run("removed prefix is breaking", func(t *testing.T) {
+		next := mustRegistry(t,
+			[]PrefixInfo{{User, "user"}, {Post, "post"}},
+			[]MultiPrefixInfo{{UserPost, "up", []Entity{User, Post}}},
+		).Definition()
+		changes := CheckCompatibility(base, next)
+		assert.Equal(t, []string{`breaking: prefix "comment" of entity 3 removed`}, changeMessages(changes))
+	})
+
+	t.Run("renumbered entity is breaking", func(t *testing.T) {
+		next := mustRegistry(t,
+			[]PrefixInfo{{User, "user"}, {Post, "post"}, {Other, "comment"}},
+			[]MultiPrefixInfo{{UserPost, "up", []Entity{User, Post}}},
+		).Definition()
+		changes := CheckCompatibility(base, next)
+		assert.Equal(t, []string{
+			`breaking: prefix "comment" renumbered from entity 3 to 4`,
+		}, changeMessages(changes))
+	})
+
+	t.Run("reordered multi components is breaking", func(t *testing.T) {
+		next := mustRegistry(t,
+			[]PrefixInfo{{User, "user"}, {Post, "post"}, {Comment, "comment"}},
+			[]MultiPrefixInfo{{UserPost, "up", []Entity{Post, User}}},
+		).Definition()
+		changes := CheckCompatibility(base, next)
+		assert.Equal(t, []string{
+			`breaking: multi type 10 ("up") components changed from [1 2] to [2 1]`,
+		}, changeMessages(changes))
+	})
+
+	t.Run("separator change is breaking", func(t *testing.T) {
+		next := base
+		next.Separator = "~"
+		changes := CheckCompatibility(base, next)
+		assert.Equal(t, []string{`breaking: separator changed from "." to "~"`}, changeMessages(changes))
+	})
+}
@@ -0,0 +1,210 @@
+package prefixed_uuids
+
+import (
+	"database/sql/driver"
+	"encoding"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+// Pair is a composite ID of two typed IDs, e.g. Pair[UserEntity,
+// PostEntity]. It serializes as the multi type of the default registry
+// whose components are the entities of A and B, so mixing up components is
+// caught at compile time instead of with ErrEntityOrderMismatch.
+type Pair[A, B EntityMarker] struct {
+	First  ID[A]
+	Second ID[B]
+}
+
+// NewPair returns the Pair of two IDs.
+func NewPair[A, B EntityMarker](first ID[A], second ID[B]) Pair[A, B] {
+	return Pair[A, B]{first, second}
+}
+
+// ParsePair parses a prefixed multi ID into a Pair using the default
+// registry.
+func ParsePair[A, B EntityMarker](s string) (Pair[A, B], error) {
+	var p Pair[A, B]
+	err := p.UnmarshalText([]byte(s))
+	return p, err
+}
+
+// String returns the prefixed form of the Pair. It panics if the default
+// registry has not been set or has no matching multi type.
+func (p Pair[A, B]) String() string {
+	return mustText(p.MarshalText())
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (p Pair[A, B]) MarshalText() ([]byte, error) {
+	return serializeComposite(
+		EntityUUID{p.First.Entity(), p.First.UUID()},
+		EntityUUID{p.Second.Entity(), p.Second.UUID()},
+	)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (p *Pair[A, B]) UnmarshalText(text []byte) error {
+	var parsed Pair[A, B]
+	err := deserializeComposite(string(text),
+		EntityUUIDPtr{parsed.First.Entity(), (*uuid.UUID)(&parsed.First)},
+		EntityUUIDPtr{parsed.Second.Entity(), (*uuid.UUID)(&parsed.Second)},
+	)
+	if err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
+
+// Value implements driver.Valuer, storing the Pair in its prefixed form.
+func (p Pair[A, B]) Value() (driver.Value, error) {
+	return textValue(p.MarshalText())
+}
+
+// Scan implements sql.Scanner.
+func (p *Pair[A, B]) Scan(src any) error {
+	return scanText(p, src)
+}
+
+// Triple is a composite ID of three typed IDs, e.g. Triple[UserEntity,
+// PostEntity, CommentEntity]. See Pair.
+type Triple[A, B, C EntityMarker] struct {
+	First  ID[A]
+	Second ID[B]
+	Third  ID[C]
+}
+
+// NewTriple returns the Triple of three IDs.
+func NewTriple[A, B, C EntityMarker](first ID[A], second ID[B], third ID[C]) Triple[A, B, C] {
+	return Triple[A, B, C]{first, second, third}
+}
+
+// ParseTriple parses a prefixed multi ID into a Triple using the default
+// registry.
+func ParseTriple[A, B, C EntityMarker](s string) (Triple[A, B, C], error) {
+	var t Triple[A, B, C]
+	err := t.UnmarshalText([]byte(s))
+	return t, err
+}
+
+// String returns the prefixed form of the Triple. It panics if the default
+// registry has not been set or has no matching multi type.
+func (t Triple[A, B, C]) String() string {
+	return mustText(t.MarshalText())
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (t Triple[A, B, C]) MarshalText() ([]byte, error) {
+	return serializeComposite(
+		EntityUUID{t.First.Entity(), t.First.UUID()},
+		EntityUUID{t.Second.Entity(), t.Second.UUID()},
+		EntityUUID{t.Third.Entity(), t.Third.UUID()},
+	)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (t *Triple[A, B, C]) UnmarshalText(text []byte) error {
+	var parsed Triple[A, B, C]
+	err := deserializeComposite(string(text),
+		EntityUUIDPtr{parsed.First.Entity(), (*uuid.UUID)(&parsed.First)},
+		EntityUUIDPtr{parsed.Second.Entity(), (*uuid.UUID)(&parsed.Second)},
+		EntityUUIDPtr{parsed.Third.Entity(), (*uuid.UUID)(&parsed.Third)},
+	)
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+// Value implements driver.Valuer, storing the Triple in its prefixed form.
+func (t Triple[A, B, C]) Value() (driver.Value, error) {
+	return textValue(t.MarshalText())
+}
+
+// Scan implements sql.Scanner.
+func (t *Triple[A, B, C]) Scan(src any) error {
+	return scanText(t, src)
+}
+
+// multiEntity returns the multi type with exactly the given components.
+func (r *Registry) multiEntity(components ...Entity) (Entity, error) {
+	found := NullEntity
+	for entity := range r.multi {
+		if !slices.Equal(r.flatComponents(entity), components) {
+			continue
+		}
+		if found != NullEntity {
+			return NullEntity, fmt.Errorf("%w: multi types %d and %d both have components %v", ErrNotMultiEntity, min(found, entity), max(found, entity), components)
+		}
+		found = entity
+	}
+	if found == NullEntity {
+		return NullEntity, fmt.Errorf("%w: no multi type has components %v", ErrNotMultiEntity, components)
+	}
+	return found, nil
+}
+
+func serializeComposite(pairs ...EntityUUID) ([]byte, error) {
+	r, err := defaultOrErr()
+	if err != nil {
+		return nil, err
+	}
+	components := make([]Entity, len(pairs))
+	for i, pair := range pairs {
+		components[i] = pair.Entity
+	}
+	entity, err := r.multiEntity(components...)
+	if err != nil {
+		return nil, err
+	}
+	s, err := r.SerializeMulti(entity, pairs...)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(s), nil
+}
+
+func deserializeComposite(s string, targets ...EntityUUIDPtr) error {
+	r, err := defaultOrErr()
+	if err != nil {
+		return err
+	}
+	components := make([]Entity, len(targets))
+	for i, target := range targets {
+		components[i] = target.Entity
+	}
+	entity, err := r.multiEntity(components...)
+	if err != nil {
+		return err
+	}
+	return r.DeserializeMulti(entity, s, targets...)
+}
+
+func mustText(text []byte, err error) string {
+	if err != nil {
+		panic(err)
+	}
+	return string(text)
+}
+
+func textValue(text []byte, err error) (driver.Value, error) {
+	if err != nil {
+		return nil, err
+	}
+	return string(text), nil
+}
+
+func scanText(dst encoding.TextUnmarshaler, src any) error {
+	switch src := src.(type) {
+	case string:
+		return dst.UnmarshalText([]byte(src))
+	case []byte:
+		return dst.UnmarshalText(src)
+	default:
+		return fmt.Errorf("cannot scan %T into a composite id", src)
+	}
+}
@@ -0,0 +1,85 @@
+package prefixed_uuids
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type commentMarker struct{}
+
+func (commentMarker) Entity() Entity { return Comment }
+
+func TestPair(t *testing.T) {
+	withDefault(t, prefixer)
+	userID := NewID[userMarker](uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e"))
+	postID := NewID[postMarker](uuid.MustParse("0195e37c-1a2b-7c3d-8e4f-5a6b7c8d9e0f"))
+
+	pair := NewPair(userID, postID)
+	expected, err := prefixer.SerializeMulti(UserPost, EntityUUID{User, userID.UUID()}, EntityUUID{Post, postID.UUID()})
+	assert.NoError(t, err)
+	assert.Equal(t, expected, pair.String())
+
+	parsed, err := ParsePair[userMarker, postMarker](expected)
+	assert.NoError(t, err)
+	assert.Equal(t, pair, parsed)
+
+	// The components must match a multi type in order.
+	_, err = NewPair(postID, userID).MarshalText()
+	assert.ErrorIs(t, err, ErrNotMultiEntity)
+	_, err = ParsePair[postMarker, userMarker](expected)
+	assert.ErrorIs(t, err, ErrNotMultiEntity)
+	_, err = ParsePair[userMarker, postMarker](userID.String())
+	assert.ErrorIs(t, err, ErrEntityMismatch)
+
+	type payload struct {
+		Key Pair[userMarker, postMarker] `json:"key"`
+	}
+	data, err := json.Marshal(payload{pair})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"key":"`+expected+`"}`, string(data))
+	var decoded payload
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, pair, decoded.Key)
+}
+
+func TestTriple(t *testing.T) {
+	withDefault(t, prefixer)
+	userID := NewID[userMarker](uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e"))
+	postID := NewID[postMarker](uuid.MustParse("0195e37c-1a2b-7c3d-8e4f-5a6b7c8d9e0f"))
+	commentID := NewID[commentMarker](uuid.MustParse("0195e37d-2b3c-7d4e-9f5a-6b7c8d9e0f1a"))
+
+	triple := NewTriple(userID, postID, commentID)
+	value, err := triple.Value()
+	assert.NoError(t, err)
+	expected, err := prefixer.SerializeMulti(UserPostComment,
+		EntityUUID{User, userID.UUID()}, EntityUUID{Post, postID.UUID()}, EntityUUID{Comment, commentID.UUID()})
+	assert.NoError(t, err)
+	assert.Equal(t, expected, value)
+
+	var scanned Triple[userMarker, postMarker, commentMarker]
+	assert.NoError(t, scanned.Scan(value))
+	assert.Equal(t, triple, scanned)
+	scanned = Triple[userMarker, postMarker, commentMarker]{}
+	assert.NoError(t, scanned.Scan([]byte(expected)))
+	assert.Equal(t, triple, scanned)
+	assert.Error(t, scanned.Scan(nil))
+	assert.Error(t, scanned.Scan(42))
+}
+
+func TestCompositeAmbiguousMultiType(t *testing.T) {
+	r := mustRegistry(t, []PrefixInfo{{User, "user"}, {Post, "post"}}, []MultiPrefixInfo{
+		{UserPost, "up", []Entity{User, Post}},
+		{Other, "other", []Entity{User, Post}},
+	})
+	withDefault(t, r)
+	_, err := NewPair(NewID[userMarker](uuid.Nil), NewID[postMarker](uuid.Nil)).MarshalText()
+	assert.ErrorIs(t, err, ErrNotMultiEntity)
+	assert.ErrorContains(t, err, "multi types 4 and 10 both have components [1 2]")
+
+	withDefault(t, nil)
+	_, err = ParsePair[userMarker, postMarker]("up.x")
+	assert.ErrorIs(t, err, ErrDefaultRegistryNotSet)
+}
@@ -0,0 +1,140 @@
+package prefixed_uuids
+
+import (
+	"fmt"
+	"slices"
+)
+
+// CompressionSharedPrefix is the multi payload compression enabled by
+// Registry.WithCompression.
+const CompressionSharedPrefix = "shared_prefix"
+
+// compressionV1 is the version marker at the start of compressed payloads.
+const compressionV1 = 1
+
+// WithCompression enables shared-prefix compression of multi type payloads.
+// UUIDv7s created close together share the leading bytes of their 48-bit
+// timestamps, so every UUID after the first is stored as the number of
+// leading bytes it shares with the previous one, followed by the rest of
+// its bytes. A version marker is written first.
+//
+// A payload is only compressed when that makes it shorter, and compressed
+// payloads never have the length of an uncompressed one, so DeserializeMulti
+// reads both transparently whether or not compression is enabled. IDs of
+// list types are never compressed.
+//
+// Compressed payloads have variable length, so compression can't be used
+// with '_' or '-' separators.
+func (r *Registry) WithCompression() (*Registry, error) {
+	if isPayloadChar(r.separator) {
+		return nil, fmt.Errorf("%w: compression is not supported with separator %q", ErrInvalidSeparator, r.separator)
+	}
+	r.compression = CompressionSharedPrefix
+	return r, nil
+}
+
+// compress returns the compressed form of the payload of a multi type, or
+// payload itself if compression is disabled or doesn't make it shorter.
+func (r *Registry) compress(entity Entity, components []Entity, payload []byte) []byte {
+	if r.compression == "" || r.isList(entity) {
+		return payload
+	}
+	present, rest, err := readBitmap(components, payload)
+	if err != nil {
+		return payload
+	}
+	compressed := []byte{compressionV1}
+	compressed = append(compressed, payload[:len(payload)-len(rest)]...)
+
+	var prev []byte
+	for i, c := range components {
+		if !present[i] {
+			continue
+		}
+		if r.componentSize(c) > 16 {
+			compressed = append(compressed, rest[0])
+			rest = rest[1:]
+		}
+		current := rest[:16]
+		rest = rest[16:]
+		if prev == nil {
+			compressed = append(compressed, current...)
+		} else {
+			shared := sharedPrefixLen(prev, current)
+			compressed = append(compressed, byte(shared))
+			compressed = append(compressed, current[shared:]...)
+		}
+		prev = current
+	}
+
+	if len(compressed) >= len(payload) || slices.Contains(r.multiPayloadLengths(components), len(compressed)) {
+		return payload
+	}
+	return compressed
+}
+
+// decompress returns the uncompressed form of the payload of a multi type.
+// Payloads which have the length of an uncompressed payload, and payloads
+// of list types, which are never compressed, are returned as is.
+func (r *Registry) decompress(entity Entity, components []Entity, payload []byte) ([]byte, error) {
+	if r.isList(entity) || slices.Contains(r.multiPayloadLengths(components), len(payload)) {
+		return payload, nil
+	}
+	if len(payload) == 0 || payload[0] != compressionV1 {
+		return nil, fmt.Errorf("%w", ErrInvalidUUIDFormat)
+	}
+	present, rest, err := readBitmap(components, payload[1:])
+	if err != nil {
+		return nil, err
+	}
+	decompressed := make([]byte, 0, 17*len(components)+len(payload))
+	decompressed = append(decompressed, payload[1:len(payload)-len(rest)]...)
+
+	var prev []byte
+	for i, c := range components {
+		if !present[i] {
+			continue
+		}
+		if r.componentSize(c) > 16 {
+			if len(rest) < 1 {
+				return nil, fmt.Errorf("%w", ErrInvalidUUIDFormat)
+			}
+			decompressed = append(decompressed, rest[0])
+			rest = rest[1:]
+		}
+		shared := 0
+		if prev != nil {
+			if len(rest) < 1 || rest[0] > 16 {
+				return nil, fmt.Errorf("%w: invalid shared prefix", ErrInvalidUUIDFormat)
+			}
+			shared = int(rest[0])
+			rest = rest[1:]
+		}
+		if len(rest) < 16-shared {
+			return nil, fmt.Errorf("%w", ErrInvalidUUIDFormat)
+		}
+		start := len(decompressed)
+		decompressed = append(decompressed, prev[:shared]...)
+		decompressed = append(decompressed, rest[:16-shared]...)
+		rest = rest[16-shared:]
+		prev = decompressed[start:]
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w", ErrInvalidUUIDFormat)
+	}
+	return decompressed, nil
+}
+
+// isList reports whether entity is a list type.
+func (r *Registry) isList(entity Entity) bool {
+	_, ok := r.lists[entity]
+	return ok
+}
+
+func sharedPrefixLen(a, b []byte) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,207 @@
+package prefixed_uuids
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// v7UUIDs returns n UUIDv7s created stepMillis apart.
+func v7UUIDs(n int, stepMillis uint64) []uuid.UUID {
+	uuids := make([]uuid.UUID, n)
+	for i := range uuids {
+		u := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+		ms := uint64(0x0195e37bf93f) + uint64(i)*stepMillis
+		for b := 0; b < 6; b++ {
+			u[b] = byte(ms >> (40 - 8*b))
+		}
+		u[15] = byte(i)
+		uuids[i] = u
+	}
+	return uuids
+}
+
+func newCompressedRegistry(t testing.TB) *Registry {
+	r, err := NewRegistry2(
+		[]PrefixInfo{{User, "user"}, {Post, "post"}, {Comment, "comment"}, {Photo, "photo"}},
+		[]MultiPrefixInfo{
+			{UserPostComment, "upc", []Entity{User, Post, Comment}},
+			{UserPostMaybeComment, "upmc", []Entity{User, Post, Optional(Comment)}},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, err = r.WithUnions(UnionInfo{Commentable, []Entity{Post, Photo}}); err != nil {
+		t.Fatal(err)
+	}
+	if r, err = r.WithMulti(MultiPrefixInfo{UserCommentRef, "ucr", []Entity{User, Commentable}}); err != nil {
+		t.Fatal(err)
+	}
+	if r, err = r.WithCompression(); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestCompressionRoundTrip(t *testing.T) {
+	r := newCompressedRegistry(t)
+	plain := newCompressedRegistry(t)
+	plain.compression = ""
+
+	uuids := v7UUIDs(3, 10)
+	pairs := []EntityUUID{{User, uuids[0]}, {Post, uuids[1]}, {Comment, uuids[2]}}
+	compressed, err := r.SerializeMulti(UserPostComment, pairs...)
+	assert.NoError(t, err)
+	uncompressed, err := plain.SerializeMulti(UserPostComment, pairs...)
+	assert.NoError(t, err)
+	// 1 version byte + 16 bytes + 2 * (1 shared length byte + 11 bytes)
+	assert.Len(t, compressed, len("upc.")+base64withNoPadding.EncodedLen(41))
+	assert.Len(t, uncompressed, len("upc.")+base64withNoPadding.EncodedLen(48))
+
+	// Both forms are read by registries with and without compression.
+	for _, reader := range []*Registry{r, plain} {
+		for _, id := range []string{compressed, uncompressed} {
+			parsed, err := reader.DeserializeMultiEntities(UserPostComment, id)
+			assert.NoError(t, err)
+			assert.Equal(t, pairs, parsed)
+		}
+	}
+
+	var user, post, comment uuid.UUID
+	assert.NoError(t, r.DeserializeMulti(UserPostComment, compressed,
+		EntityUUIDPtr{User, &user}, EntityUUIDPtr{Post, &post}, EntityUUIDPtr{Comment, &comment}))
+	assert.Equal(t, uuids, []uuid.UUID{user, post, comment})
+
+	// Optional and union components.
+	for _, tt := range []struct {
+		entity Entity
+		pairs  []EntityUUID
+	}{
+		{UserPostMaybeComment, []EntityUUID{{User, uuids[0]}, {Post, uuids[1]}}},
+		{UserPostMaybeComment, []EntityUUID{{User, uuids[0]}, {Post, uuids[1]}, {Comment, uuids[2]}}},
+		{UserCommentRef, []EntityUUID{{User, uuids[0]}, {Photo, uuids[1]}}},
+	} {
+		encoded, err := r.SerializeMulti(tt.entity, tt.pairs...)
+		assert.NoError(t, err)
+		uncompressed, err := plain.SerializeMulti(tt.entity, tt.pairs...)
+		assert.NoError(t, err)
+		assert.Less(t, len(encoded), len(uncompressed))
+		parsed, err := plain.DeserializeMultiEntities(tt.entity, encoded)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.pairs, parsed)
+	}
+}
+
+func TestCompressionFallsBack(t *testing.T) {
+	r := newCompressedRegistry(t)
+	plain := newCompressedRegistry(t)
+	plain.compression = ""
+
+	// Random UUIDs share no prefix, so compressing them would only add the
+	// version and length bytes.
+	pairs := []EntityUUID{
+		{User, uuid.MustParse("9b2f4c7e-3d1a-4e8b-a6c5-0f7d2e9b1a43")},
+		{Post, uuid.MustParse("41c8e0d2-7f6b-4a39-8e15-c3b9d7a2f608")},
+		{Comment, uuid.MustParse("e7a3b915-0c4d-4f62-b8e1-5d2a6c9f3b07")},
+	}
+	compressed, err := r.SerializeMulti(UserPostComment, pairs...)
+	assert.NoError(t, err)
+	uncompressed, err := plain.SerializeMulti(UserPostComment, pairs...)
+	assert.NoError(t, err)
+	assert.Equal(t, uncompressed, compressed)
+}
+
+func TestCompressionErrors(t *testing.T) {
+	r := newCompressedRegistry(t)
+	uuids := v7UUIDs(3, 10)
+	encoded, err := r.SerializeMulti(UserPostComment, EntityUUID{User, uuids[0]}, EntityUUID{Post, uuids[1]}, EntityUUID{Comment, uuids[2]})
+	assert.NoError(t, err)
+	payload, err := base64withNoPadding.DecodeString(encoded[len("upc."):])
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		payload []byte
+	}{
+		{"unknown version", append([]byte{2}, payload[1:]...)},
+		{"truncated", payload[:len(payload)-1]},
+		{"trailing bytes", append(append([]byte(nil), payload...), 0)},
+		{"shared prefix too long", append(append(append([]byte(nil), payload[:17]...), 17), payload[18:]...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := r.DeserializeMultiEntities(UserPostComment, "upc."+base64withNoPadding.EncodeToString(tt.payload))
+			assert.ErrorIs(t, err, ErrInvalidUUIDFormat)
+		})
+	}
+
+	_, err = r.WithSeparator("_")
+	assert.ErrorIs(t, err, ErrInvalidSeparator)
+	underscore, err := mustRegistry(t, []PrefixInfo{{User, "user"}}, nil).WithSeparator("_")
+	assert.NoError(t, err)
+	_, err = underscore.WithCompression()
+	assert.ErrorIs(t, err, ErrInvalidSeparator)
+}
+
+func TestCompressionSkipsLists(t *testing.T) {
+	r, err := newListRegistry(t).WithCompression()
+	assert.NoError(t, err)
+	uuids := v7UUIDs(2, 0)
+
+	list, err := r.SerializeMulti(PostSelection, postPairs(uuids)...)
+	assert.NoError(t, err)
+	assert.Len(t, list, len("posts.")+base64withNoPadding.EncodedLen(32))
+
+	// The compressed form of the same list is not a second encoding of it.
+	payload := append([]byte{compressionV1}, uuids[0][:]...)
+	payload = append(payload, 15, uuids[1][15])
+	id := "posts." + base64withNoPadding.EncodeToString(payload)
+	var first, second uuid.UUID
+	err = r.DeserializeMulti(PostSelection, id, EntityUUIDPtr{Post, &first}, EntityUUIDPtr{Post, &second})
+	assert.ErrorIs(t, err, ErrInvalidUUIDFormat)
+	_, err = r.DeserializeList(PostSelection, id)
+	assert.ErrorIs(t, err, ErrInvalidUUIDFormat)
+	_, err = r.DeserializeMultiEntities(PostSelection, id)
+	assert.ErrorIs(t, err, ErrInvalidUUIDFormat)
+}
+
+func TestCompressionDefinition(t *testing.T) {
+	def := newCompressedRegistry(t).Definition()
+	assert.Equal(t, CompressionSharedPrefix, def.Compression)
+	assert.Contains(t, string(def.Canonical()), "encoding base64url\ncompression shared_prefix\n")
+
+	plain := def
+	plain.Compression = ""
+	assert.NotContains(t, string(plain.Canonical()), "compression")
+	assert.Equal(t, []string{
+		`risky: compression changed from "" to "shared_prefix"`,
+	}, changeMessages(CheckCompatibility(plain, def)))
+}
+
+func BenchmarkMultiCompression(b *testing.B) {
+	for _, step := range []uint64{1, 1000, 60_000} {
+		uuids := v7UUIDs(3, step)
+		pairs := []EntityUUID{{User, uuids[0]}, {Post, uuids[1]}, {Comment, uuids[2]}}
+		for _, compression := range []string{"", CompressionSharedPrefix} {
+			name := "none"
+			if compression != "" {
+				name = compression
+			}
+			b.Run(fmt.Sprintf("%dms/%s", step, name), func(b *testing.B) {
+				r := newCompressedRegistry(b)
+				r.compression = compression
+				var encoded string
+				for b.Loop() {
+					encoded, _ = r.SerializeMulti(UserPostComment, pairs...)
+					if _, err := r.DeserializeMultiEntities(UserPostComment, encoded); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(len(encoded)-len("upc.")), "payload_chars")
+			})
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package prefixed_uuids
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+)
+
+var defaultRegistry atomic.Pointer[Registry]
+
+// SetDefault sets the package-level default registry used by Serialize,
+// Deserialize, DeserializeWithEntity, SerializeMulti and the ID type. It
+// can only be set once, typically from main or an init function, and the
+// registry must be fully configured (separator etc.) before it is set.
+func SetDefault(r *Registry) error {
+	if r == nil {
+		return fmt.Errorf("%w: registry is nil", ErrDefaultRegistryNotSet)
+	}
+	if !defaultRegistry.CompareAndSwap(nil, r) {
+		return fmt.Errorf("%w", ErrDefaultRegistryAlreadySet)
+	}
+	return nil
+}
+
+// Default returns the default registry, or nil if it has not been set.
+func Default() *Registry {
+	return defaultRegistry.Load()
+}
+
+func defaultOrErr() (*Registry, error) {
+	r := defaultRegistry.Load()
+	if r == nil {
+		return nil, fmt.Errorf("%w", ErrDefaultRegistryNotSet)
+	}
+	return r, nil
+}
+
+// Serialize serializes uuid using the default registry. It panics if the
+// default registry has not been set.
+func Serialize(entity Entity, uuid uuid.UUID) string {
+	r, err := defaultOrErr()
+	if err != nil {
+		panic(err)
+	}
+	return r.Serialize(entity, uuid)
+}
+
+// Deserialize deserializes uuidStr using the default registry.
+func Deserialize(entity Entity, uuidStr string) (uuid.UUID, error) {
+	r, err := defaultOrErr()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return r.Deserialize(entity, uuidStr)
+}
+
+// DeserializeWithEntity deserializes uuidStr using the default registry.
+func DeserializeWithEntity(uuidStr string) (Entity, uuid.UUID, error) {
+	r, err := defaultOrErr()
+	if err != nil {
+		return NullEntity, uuid.Nil, err
+	}
+	return r.DeserializeWithEntity(uuidStr)
+}
+
+// SerializeMulti serializes pairs using the default registry.
+func SerializeMulti(entity Entity, pairs ...EntityUUID) (string, error) {
+	r, err := defaultOrErr()
+	if err != nil {
+		return "", err
+	}
+	return r.SerializeMulti(entity, pairs...)
+}
+
+// DeserializeMulti deserializes uuidStr into targets using the default
+// registry.
+func DeserializeMulti(entity Entity, uuidStr string, targets ...EntityUUIDPtr) error {
+	r, err := defaultOrErr()
+	if err != nil {
+		return err
+	}
+	return r.DeserializeMulti(entity, uuidStr, targets...)
+}
+
+// EntityMarker is implemented by the (usually empty struct) types used to
+// tie an ID type to an entity at compile time:
+//
+//	type UserEntity struct{}
+//
+//	func (UserEntity) Entity() Entity { return User }
+//
+//	type UserID = ID[UserEntity]
+type EntityMarker interface {
+	Entity() Entity
+}
+
+// ID is a UUID typed with the entity it belongs to. It serializes to and
+// from its prefixed form using the default registry, which makes it usable
+// directly in JSON payloads and anywhere a TextMarshaler is accepted.
+type ID[T EntityMarker] uuid.UUID
+
+// NewID returns the ID of the given UUID.
+func NewID[T EntityMarker](u uuid.UUID) ID[T] {
+	return ID[T](u)
+}
+
+// ParseID parses a prefixed ID of the entity of T using the default registry.
+func ParseID[T EntityMarker](s string) (ID[T], error) {
+	var id ID[T]
+	err := id.UnmarshalText([]byte(s))
+	return id, err
+}
+
+// Entity returns the entity of the ID.
+func (id ID[T]) Entity() Entity {
+	var marker T
+	return marker.Entity()
+}
+
+// UUID returns the underlying UUID.
+func (id ID[T]) UUID() uuid.UUID {
+	return uuid.UUID(id)
+}
+
+// String returns the prefixed form of the ID. It panics if the default
+// registry has not been set.
+func (id ID[T]) String() string {
+	return Serialize(id.Entity(), uuid.UUID(id))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (id ID[T]) MarshalText() ([]byte, error) {
+	r, err := defaultOrErr()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(r.Serialize(id.Entity(), uuid.UUID(id))), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (id *ID[T]) UnmarshalText(text []byte) error {
+	parsed, err := Deserialize(id.Entity(), string(text))
+	if err != nil {
+		return err
+	}
+	*id = ID[T](parsed)
+	return nil
+}
@@ -0,0 +1,133 @@
+package prefixed_uuids
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type userMarker struct{}
+
+func (userMarker) Entity() Entity { return User }
+
+type postMarker struct{}
+
+func (postMarker) Entity() Entity { return Post }
+
+type testUserID = ID[userMarker]
+type testPostID = ID[postMarker]
+
+// withDefault sets the default registry for the duration of a test.
+func withDefault(t *testing.T, r *Registry) {
+	t.Helper()
+	defaultRegistry.Store(nil)
+	t.Cleanup(func() { defaultRegistry.Store(nil) })
+	if r != nil {
+		assert.NoError(t, SetDefault(r))
+	}
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	withDefault(t, prefixer)
+	u := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+
+	assert.Equal(t, prefixer, Default())
+	assert.Equal(t, "user.AZXje_k_dRiprKK-aEY8fg", Serialize(User, u))
+
+	parsed, err := Deserialize(User, "user.AZXje_k_dRiprKK-aEY8fg")
+	assert.NoError(t, err)
+	assert.Equal(t, u, parsed)
+
+	entity, parsed, err := DeserializeWithEntity("post.AZXje_k_dRiprKK-aEY8fg")
+	assert.NoError(t, err)
+	assert.Equal(t, Post, entity)
+	assert.Equal(t, u, parsed)
+
+	encoded, err := SerializeMulti(UserPost, EntityUUID{User, u}, EntityUUID{Post, u})
+	assert.NoError(t, err)
+	var parsedUser, parsedPost uuid.UUID
+	assert.NoError(t, DeserializeMulti(UserPost, encoded, EntityUUIDPtr{User, &parsedUser}, EntityUUIDPtr{Post, &parsedPost}))
+	assert.Equal(t, u, parsedUser)
+	assert.Equal(t, u, parsedPost)
+
+	assert.ErrorIs(t, SetDefault(prefixer), ErrDefaultRegistryAlreadySet)
+}
+
+func TestDefaultRegistryNotSet(t *testing.T) {
+	withDefault(t, nil)
+
+	assert.Nil(t, Default())
+	assert.Panics(t, func() { Serialize(User, uuid.New()) })
+	_, err := Deserialize(User, "user.AZXje_k_dRiprKK-aEY8fg")
+	assert.ErrorIs(t, err, ErrDefaultRegistryNotSet)
+	_, _, err = DeserializeWithEntity("user.AZXje_k_dRiprKK-aEY8fg")
+	assert.ErrorIs(t, err, ErrDefaultRegistryNotSet)
+	_, err = SerializeMulti(UserPost)
+	assert.ErrorIs(t, err, ErrDefaultRegistryNotSet)
+	assert.ErrorIs(t, DeserializeMulti(UserPost, "up.x"), ErrDefaultRegistryNotSet)
+	_, err = testUserID{}.MarshalText()
+	assert.ErrorIs(t, err, ErrDefaultRegistryNotSet)
+
+	assert.ErrorIs(t, SetDefault(nil), ErrDefaultRegistryNotSet)
+}
+
+func TestSetDefaultConcurrently(t *testing.T) {
+	withDefault(t, nil)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- SetDefault(prefixer)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		assert.ErrorIs(t, err, ErrDefaultRegistryAlreadySet)
+	}
+	assert.Equal(t, 1, succeeded)
+}
+
+func TestTypedID(t *testing.T) {
+	withDefault(t, prefixer)
+	u := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+
+	id := NewID[userMarker](u)
+	assert.Equal(t, User, id.Entity())
+	assert.Equal(t, u, id.UUID())
+	assert.Equal(t, "user.AZXje_k_dRiprKK-aEY8fg", id.String())
+
+	parsed, err := ParseID[userMarker]("user.AZXje_k_dRiprKK-aEY8fg")
+	assert.NoError(t, err)
+	assert.Equal(t, id, parsed)
+
+	_, err = ParseID[postMarker]("user.AZXje_k_dRiprKK-aEY8fg")
+	assert.ErrorIs(t, err, ErrEntityMismatch)
+
+	type payload struct {
+		UserID testUserID `json:"user_id"`
+		PostID testPostID `json:"post_id"`
+	}
+	data, err := json.Marshal(payload{id, NewID[postMarker](u)})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"user_id":"user.AZXje_k_dRiprKK-aEY8fg","post_id":"post.AZXje_k_dRiprKK-aEY8fg"}`, string(data))
+
+	var decoded payload
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, id, decoded.UserID)
+
+	err = json.Unmarshal([]byte(`{"user_id":"post.AZXje_k_dRiprKK-aEY8fg"}`), &decoded)
+	assert.ErrorIs(t, err, ErrEntityMismatch)
+}
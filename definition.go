@@ -0,0 +1,240 @@
+package prefixed_uuids
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// EncodingBase64URL is the default payload encoding: unpadded base64url.
+	EncodingBase64URL = "base64url"
+	// EncodingTypeID is the TypeID payload encoding: 26 characters of
+	// lowercase Crockford base32. See Registry.WithTypeID.
+	EncodingTypeID = "typeid"
+)
+
+// Definition is a serializable description of a Registry. It captures
+// everything that affects the wire format of the IDs a Registry produces
+// and accepts, so two registries can be compared without constructing them.
+type Definition struct {
+	Separator      string            `json:"separator"`
+	Encoding       string            `json:"encoding"`
+	URNNamespace   string            `json:"urn_namespace,omitempty"`
+	Prefixes       []PrefixInfo      `json:"prefixes"`
+	Aliases        []PrefixInfo      `json:"aliases,omitempty"`
+	Multi          []MultiPrefixInfo `json:"multi,omitempty"`
+	Lists          []ListPrefixInfo  `json:"lists,omitempty"`
+	Unions         []UnionInfo       `json:"unions,omitempty"`
+	Namespaces     []NamespaceInfo   `json:"namespaces,omitempty"`
+	Derivation     string            `json:"derivation,omitempty"`
+	Compression    string            `json:"compression,omitempty"`
+	TenantScoped   []Entity          `json:"tenant_scoped,omitempty"`
+	Environments   []Entity          `json:"environments,omitempty"`
+	Secrets        []Entity          `json:"secrets,omitempty"`
+	SecretChecksum string            `json:"secret_checksum,omitempty"`
+}
+
+// NamespaceInfo is the namespace used to derive UUIDs of an entity.
+type NamespaceInfo struct {
+	Entity    Entity    `json:"entity"`
+	Namespace uuid.UUID `json:"namespace"`
+}
+
+// Definition returns the definition of the registry. Entries are sorted by
+// entity, and aliases (additional prefixes accepted for an entity which are
+// not used by Serialize) are listed separately.
+func (r *Registry) Definition() Definition {
+	def := Definition{
+		Separator:      r.separator,
+		Encoding:       r.encoding,
+		URNNamespace:   r.urnNamespace,
+		Compression:    r.compression,
+		TenantScoped:   sortedEntities(r.tenantScoped),
+		Environments:   sortedEntities(r.envEntities),
+		Secrets:        sortedEntities(r.secrets),
+		SecretChecksum: r.secretChecksum,
+	}
+	for entity, prefix := range r.prefixes {
+		if components, ok := r.multi[entity]; ok {
+			def.Multi = append(def.Multi, MultiPrefixInfo{entity, prefix, append([]Entity(nil), components...)})
+			continue
+		}
+		if list, ok := r.lists[entity]; ok {
+			def.Lists = append(def.Lists, list)
+			continue
+		}
+		def.Prefixes = append(def.Prefixes, PrefixInfo{entity, prefix})
+	}
+	for prefix, entity := range r.reverse {
+		if r.prefixes[entity] != prefix && r.envPrefixes[prefix] == "" {
+			def.Aliases = append(def.Aliases, PrefixInfo{entity, prefix})
+		}
+	}
+
+	sort.Slice(def.Prefixes, func(i, j int) bool { return def.Prefixes[i].Entity < def.Prefixes[j].Entity })
+	sort.Slice(def.Aliases, func(i, j int) bool {
+		if def.Aliases[i].Entity != def.Aliases[j].Entity {
+			return def.Aliases[i].Entity < def.Aliases[j].Entity
+		}
+		return def.Aliases[i].Prefix < def.Aliases[j].Prefix
+	})
+	sort.Slice(def.Multi, func(i, j int) bool { return def.Multi[i].Entity < def.Multi[j].Entity })
+	sort.Slice(def.Lists, func(i, j int) bool { return def.Lists[i].Entity < def.Lists[j].Entity })
+	for entity, members := range r.unions {
+		def.Unions = append(def.Unions, UnionInfo{entity, append([]Entity(nil), members...)})
+	}
+	sort.Slice(def.Unions, func(i, j int) bool { return def.Unions[i].Entity < def.Unions[j].Entity })
+	if len(r.namespaces) > 0 {
+		for entity, namespace := range r.namespaces {
+			def.Namespaces = append(def.Namespaces, NamespaceInfo{entity, namespace})
+		}
+		sort.Slice(def.Namespaces, func(i, j int) bool { return def.Namespaces[i].Entity < def.Namespaces[j].Entity })
+		def.Derivation = r.derivation.String()
+	}
+	return def
+}
+
+// NewRegistryFromDefinition creates the registry described by def, e.g. one
+// loaded with LoadDefinition by a command line tool. Tenant scoped entities
+// are rejected since their key is not part of the definition.
+func NewRegistryFromDefinition(def Definition) (*Registry, error) {
+	if len(def.TenantScoped) > 0 {
+		return nil, fmt.Errorf("tenant scoped entities [%s] need a key, register them with WithTenantScope", formatComponents(def.TenantScoped))
+	}
+	// Canonical prefixes come last so that they are used by Serialize.
+	r, err := NewRegistry2(append(slices.Clone(def.Aliases), def.Prefixes...), nil)
+	if err != nil {
+		return nil, err
+	}
+	if r, err = r.WithUnions(def.Unions...); err != nil {
+		return nil, err
+	}
+	// Nested multi types must be registered after their components.
+	pending := slices.Clone(def.Multi)
+	for len(pending) > 0 {
+		var next []MultiPrefixInfo
+		for _, info := range pending {
+			if !r.componentsRegistered(info.Entities) {
+				next = append(next, info)
+				continue
+			}
+			if r, err = r.WithMulti(info); err != nil {
+				return nil, err
+			}
+		}
+		if len(next) == len(pending) {
+			// Report why the first one can't be registered.
+			_, err := r.WithMulti(next[0])
+			return nil, err
+		}
+		pending = next
+	}
+	if r, err = r.WithLists(def.Lists...); err != nil {
+		return nil, err
+	}
+
+	for _, n := range def.Namespaces {
+		if r, err = r.WithNamespace(n.Entity, n.Namespace); err != nil {
+			return nil, err
+		}
+	}
+	switch def.Derivation {
+	case "", DeriveV5.String():
+	case DeriveSHA256.String():
+		r.derivation = DeriveSHA256
+	default:
+		return nil, fmt.Errorf("unknown derivation %q", def.Derivation)
+	}
+
+	if len(def.Environments) > 0 {
+		if r, err = r.WithEnvironments(def.Environments...); err != nil {
+			return nil, err
+		}
+	}
+	if len(def.Secrets) > 0 {
+		if r, err = r.WithSecrets(def.Secrets...); err != nil {
+			return nil, err
+		}
+	}
+	switch def.SecretChecksum {
+	case "":
+	case SecretChecksumCRC32:
+		r.secretChecksum = SecretChecksumCRC32
+	default:
+		return nil, fmt.Errorf("unknown secret checksum %q", def.SecretChecksum)
+	}
+	switch def.Compression {
+	case "":
+	case CompressionSharedPrefix:
+		r.compression = CompressionSharedPrefix
+	default:
+		return nil, fmt.Errorf("unknown compression %q", def.Compression)
+	}
+	if def.URNNamespace != "" {
+		if r, err = r.WithURNNamespace(def.URNNamespace); err != nil {
+			return nil, err
+		}
+	}
+
+	// The separator is set last, once everything it must not make
+	// ambiguous is registered.
+	switch def.Encoding {
+	case "", EncodingBase64URL:
+		if def.Separator != "" && def.Separator != defaultSeparator {
+			if r, err = r.WithSeparator(def.Separator); err != nil {
+				return nil, err
+			}
+		}
+	case EncodingTypeID:
+		if r, err = r.WithTypeID(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown encoding %q", def.Encoding)
+	}
+	return r, nil
+}
+
+// componentsRegistered reports whether the entities and unions used by the
+// given multi type components are registered.
+func (r *Registry) componentsRegistered(components []Entity) bool {
+	for _, c := range components {
+		e, _ := splitOptional(c)
+		_, registered := r.prefixes[e]
+		if _, union := r.unions[e]; !registered && !union {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadDefinition decodes a JSON encoded Definition.
+func ReadDefinition(rd io.Reader) (Definition, error) {
+	var def Definition
+	if err := json.NewDecoder(rd).Decode(&def); err != nil {
+		return Definition{}, fmt.Errorf("decoding registry definition: %w", err)
+	}
+	if def.Separator == "" {
+		def.Separator = defaultSeparator
+	}
+	if def.Encoding == "" {
+		def.Encoding = EncodingBase64URL
+	}
+	return def, nil
+}
+
+// LoadDefinition reads a JSON encoded Definition from a file.
+func LoadDefinition(path string) (Definition, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Definition{}, err
+	}
+	defer f.Close()
+	return ReadDefinition(f)
+}
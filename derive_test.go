@@ -0,0 +1,149 @@
+package prefixed_uuids
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	userNamespace    = uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8") // uuid.NameSpaceDNS
+	commentNamespace = uuid.MustParse("3f1f8c6e-8a55-4a59-9a3b-7a3f6c1a2d10")
+)
+
+func newDeriveRegistry(t *testing.T) *Registry {
+	t.Helper()
+	r := mustRegistry(t, []PrefixInfo{{User, "user"}, {Post, "post"}, {Comment, "comment"}}, nil)
+	r, err := r.WithNamespace(User, userNamespace)
+	assert.NoError(t, err)
+	r, err = r.WithNamespace(Comment, commentNamespace)
+	assert.NoError(t, err)
+	return r
+}
+
+func TestDeriveV5(t *testing.T) {
+	r := newDeriveRegistry(t)
+
+	// The well known RFC 9562 example: uuid5(NAMESPACE_DNS, "python.org").
+	u, err := r.DeriveUUID(User, "python.org")
+	assert.NoError(t, err)
+	assert.Equal(t, uuid.MustParse("886313e1-3b8a-5372-9b90-0c9aee199e5d"), u)
+
+	id, err := r.Derive(User, "python.org")
+	assert.NoError(t, err)
+	assert.Equal(t, r.Serialize(User, u), id)
+
+	again, err := r.Derive(User, "python.org")
+	assert.NoError(t, err)
+	assert.Equal(t, id, again)
+
+	other, err := r.DeriveUUID(Comment, "python.org")
+	assert.NoError(t, err)
+	assert.NotEqual(t, u, other)
+
+	_, err = r.Derive(Post, "python.org")
+	assert.ErrorIs(t, err, ErrNamespaceNotSet)
+}
+
+func TestDeriveSHA256(t *testing.T) {
+	r := newDeriveRegistry(t)
+	r, err := r.WithDerivation(DeriveSHA256)
+	assert.NoError(t, err)
+
+	u, err := r.DeriveUUID(User, "cus_NffrFeUfNV2Hib")
+	assert.NoError(t, err)
+	assert.Equal(t, uuid.Version(8), u.Version())
+	assert.Equal(t, uuid.RFC4122, u.Variant())
+
+	again, err := r.DeriveUUID(User, "cus_NffrFeUfNV2Hib")
+	assert.NoError(t, err)
+	assert.Equal(t, u, again)
+
+	v5, err := newDeriveRegistry(t).DeriveUUID(User, "cus_NffrFeUfNV2Hib")
+	assert.NoError(t, err)
+	assert.NotEqual(t, v5, u)
+
+	_, err = r.WithDerivation(Derivation(42))
+	assert.Error(t, err)
+}
+
+func TestDeriveFromParent(t *testing.T) {
+	r := newDeriveRegistry(t)
+	parent := r.Serialize(User, uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e"))
+
+	child, err := r.DeriveFromParent(Comment, parent, "first")
+	assert.NoError(t, err)
+	// Derived IDs are stored, so the derivation must never change.
+	assert.Equal(t, "comment.rBGIeUOOVDeegJNGxR_pnw", child)
+	entity, u, err := r.DeserializeWithEntity(child)
+	assert.NoError(t, err)
+	assert.Equal(t, Comment, entity)
+	assert.Equal(t, uuid.Version(5), u.Version())
+
+	// A name made of the parent's UUID and the child's name derives a
+	// different ID.
+	parentUUID := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+	lookalike, err := r.Derive(Comment, string(parentUUID[:])+"first")
+	assert.NoError(t, err)
+	assert.NotEqual(t, child, lookalike)
+
+	again, err := r.DeriveFromParent(Comment, parent, "first")
+	assert.NoError(t, err)
+	assert.Equal(t, child, again)
+
+	second, err := r.DeriveFromParent(Comment, parent, "second")
+	assert.NoError(t, err)
+	assert.NotEqual(t, child, second)
+
+	// The parent's prefix doesn't matter, only its UUID.
+	sameUUID := r.Serialize(Post, uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e"))
+	fromPost, err := r.DeriveFromParent(Comment, sameUUID, "first")
+	assert.NoError(t, err)
+	assert.Equal(t, child, fromPost)
+
+	sha256Registry, err := newDeriveRegistry(t).WithDerivation(DeriveSHA256)
+	assert.NoError(t, err)
+	fromSHA256, err := sha256Registry.DeriveFromParent(Comment, parent, "first")
+	assert.NoError(t, err)
+	assert.Equal(t, "comment.OtnSVykvjGiyiQIJau8ZRQ", fromSHA256)
+	lookalike, err = sha256Registry.Derive(Comment, string(parentUUID[:])+"first")
+	assert.NoError(t, err)
+	assert.NotEqual(t, fromSHA256, lookalike)
+
+	_, err = r.DeriveFromParent(Comment, "user.invalid!", "first")
+	assert.ErrorIs(t, err, ErrInvalidUUIDBadBase64)
+	_, err = r.DeriveFromParent(Post, parent, "first")
+	assert.ErrorIs(t, err, ErrNamespaceNotSet)
+}
+
+func TestWithNamespaceValidation(t *testing.T) {
+	r := newDeriveRegistry(t)
+
+	_, err := r.WithNamespace(Other, uuid.New())
+	assert.ErrorContains(t, err, "not registered")
+	_, err = r.WithNamespace(Post, uuid.Nil)
+	assert.ErrorContains(t, err, "nil uuid")
+	_, err = r.WithNamespace(Post, userNamespace)
+	assert.ErrorContains(t, err, "already used by entity 1")
+	_, err = r.WithNamespace(User, userNamespace)
+	assert.NoError(t, err)
+}
+
+func TestDeriveDefinition(t *testing.T) {
+	r := newDeriveRegistry(t)
+	def := r.Definition()
+	assert.Equal(t, []NamespaceInfo{{User, userNamespace}, {Comment, commentNamespace}}, def.Namespaces)
+	assert.Equal(t, "v5", def.Derivation)
+	assert.Contains(t, string(def.Canonical()), "derivation v5\nnamespace 1 6ba7b810-9dad-11d1-80b4-00c04fd430c8\n")
+
+	changed := newDeriveRegistry(t)
+	_, err := changed.WithNamespace(Comment, uuid.MustParse("11111111-1111-4111-8111-111111111111"))
+	assert.NoError(t, err)
+	_, err = changed.WithDerivation(DeriveSHA256)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`breaking: derivation changed from "v5" to "sha256"`,
+		"breaking: namespace of entity 3 changed from 3f1f8c6e-8a55-4a59-9a3b-7a3f6c1a2d10 to 11111111-1111-4111-8111-111111111111",
+	}, changeMessages(CheckCompatibility(def, changed.Definition())))
+}
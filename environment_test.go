@@ -0,0 +1,150 @@
+package prefixed_uuids
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+const SecretKey Entity = 41
+
+func newEnvironmentRegistry(t *testing.T, env Environment) *Registry {
+	t.Helper()
+	r := mustRegistry(t, []PrefixInfo{{User, "user"}, {SecretKey, "sk"}}, nil)
+	r, err := r.WithEnvironments(SecretKey)
+	assert.NoError(t, err)
+	if env != "" {
+		r, err = r.WithEnvironment(env)
+		assert.NoError(t, err)
+	}
+	return r
+}
+
+func TestEnvironmentSerialize(t *testing.T) {
+	u := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+	tests := []struct {
+		env      Environment
+		expected string
+	}{
+		{"", "sk.AZXje_k_dRiprKK-aEY8fg"},
+		{EnvironmentLive, "sk_live.AZXje_k_dRiprKK-aEY8fg"},
+		{EnvironmentTest, "sk_test.AZXje_k_dRiprKK-aEY8fg"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.env), func(t *testing.T) {
+			r := newEnvironmentRegistry(t, tt.env)
+			id := r.Serialize(SecretKey, u)
+			assert.Equal(t, tt.expected, id)
+			// Other entities are not affected.
+			assert.Equal(t, "user.AZXje_k_dRiprKK-aEY8fg", r.Serialize(User, u))
+
+			entity, env, parsed, err := r.DeserializeWithEnvironment(id)
+			assert.NoError(t, err)
+			assert.Equal(t, SecretKey, entity)
+			assert.Equal(t, tt.env, env)
+			assert.Equal(t, u, parsed)
+
+			parsed, err = r.Deserialize(SecretKey, id)
+			assert.NoError(t, err)
+			assert.Equal(t, u, parsed)
+		})
+	}
+
+	r := newEnvironmentRegistry(t, EnvironmentLive)
+	id, err := r.SerializeForEnvironment(SecretKey, EnvironmentTest, u)
+	assert.NoError(t, err)
+	assert.Equal(t, "sk_test.AZXje_k_dRiprKK-aEY8fg", id)
+	_, err = r.SerializeForEnvironment(User, EnvironmentTest, u)
+	assert.ErrorContains(t, err, "not environment aware")
+	_, err = r.SerializeForEnvironment(SecretKey, "staging", u)
+	assert.ErrorContains(t, err, "unknown environment")
+}
+
+func TestEnvironmentGuard(t *testing.T) {
+	live := newEnvironmentRegistry(t, EnvironmentLive)
+	_, err := live.Deserialize(SecretKey, "sk_test.AZXje_k_dRiprKK-aEY8fg")
+	assert.ErrorIs(t, err, ErrEnvironmentMismatch)
+	assert.EqualError(t, err, `environment mismatch: "sk_test" id in a live registry`)
+	_, _, _, err = live.DeserializeWithEnvironment("sk_test.AZXje_k_dRiprKK-aEY8fg")
+	assert.ErrorIs(t, err, ErrEnvironmentMismatch)
+
+	// Test registries accept live IDs and bare prefixes.
+	test := newEnvironmentRegistry(t, EnvironmentTest)
+	_, env, _, err := test.DeserializeWithEnvironment("sk_live.AZXje_k_dRiprKK-aEY8fg")
+	assert.NoError(t, err)
+	assert.Equal(t, EnvironmentLive, env)
+	_, env, _, err = test.DeserializeWithEnvironment("sk.AZXje_k_dRiprKK-aEY8fg")
+	assert.NoError(t, err)
+	assert.Equal(t, Environment(""), env)
+
+	// Registries without an environment issue bare prefixes, which live
+	// registries only accept when told to.
+	bare := newEnvironmentRegistry(t, "").Serialize(SecretKey, uuid.Nil)
+	assert.Equal(t, "sk.AAAAAAAAAAAAAAAAAAAAAA", bare)
+	_, err = live.Deserialize(SecretKey, bare)
+	assert.ErrorIs(t, err, ErrEnvironmentMismatch)
+	assert.EqualError(t, err, `environment mismatch: "sk" id without an environment in a live registry`)
+	_, _, _, err = live.DeserializeWithEnvironment(bare)
+	assert.ErrorIs(t, err, ErrEnvironmentMismatch)
+	legacy, err := newEnvironmentRegistry(t, EnvironmentLive).WithBareEnvironmentIDs()
+	assert.NoError(t, err)
+	_, env, _, err = legacy.DeserializeWithEnvironment(bare)
+	assert.NoError(t, err)
+	assert.Equal(t, Environment(""), env)
+	_, err = legacy.Deserialize(SecretKey, "sk_test.AZXje_k_dRiprKK-aEY8fg")
+	assert.ErrorIs(t, err, ErrEnvironmentMismatch)
+
+	_, err = live.Deserialize(User, "user_live.AZXje_k_dRiprKK-aEY8fg")
+	assert.ErrorIs(t, err, ErrUnknownPrefix)
+}
+
+func TestWithEnvironmentsValidation(t *testing.T) {
+	_, err := newEnvironmentRegistry(t, "").WithEnvironment("staging")
+	assert.ErrorContains(t, err, `unknown environment "staging"`)
+
+	r := mustRegistry(t, []PrefixInfo{{User, "user"}, {SecretKey, "sk"}, {Post, "sk_test"}}, []MultiPrefixInfo{{UserPost, "up", []Entity{User, Post}}})
+	_, err = r.WithEnvironments(User, SecretKey)
+	assert.ErrorContains(t, err, `prefix "sk_test" is already registered`)
+	_, err = r.WithEnvironments(UserPost)
+	assert.ErrorContains(t, err, "entity 10 is not registered")
+	_, err = r.WithEnvironments(Comment)
+	assert.ErrorContains(t, err, "entity 3 is not registered")
+	// Failed calls are rolled back.
+	assert.Empty(t, r.Definition().Environments)
+	_, err = r.Deserialize(User, "user_live.AZXje_k_dRiprKK-aEY8fg")
+	assert.ErrorIs(t, err, ErrUnknownPrefix)
+
+	// Environment prefixes work with separators which may appear in them.
+	r = newEnvironmentRegistry(t, EnvironmentLive)
+	r, err = r.WithSeparator("_")
+	assert.NoError(t, err)
+	u := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+	id := r.Serialize(SecretKey, u)
+	assert.Equal(t, "sk_live_AZXje_k_dRiprKK-aEY8fg", id)
+	_, env, parsed, err := r.DeserializeWithEnvironment(id)
+	assert.NoError(t, err)
+	assert.Equal(t, EnvironmentLive, env)
+	assert.Equal(t, u, parsed)
+}
+
+func TestEnvironmentDefinition(t *testing.T) {
+	def := newEnvironmentRegistry(t, EnvironmentLive).Definition()
+	assert.Equal(t, []Entity{SecretKey}, def.Environments)
+	assert.Empty(t, def.Aliases)
+	assert.Contains(t, string(def.Canonical()), "\nenvironments 41\n")
+	// The registry's own environment is deployment configuration.
+	assert.Equal(t, def.Fingerprint(), newEnvironmentRegistry(t, EnvironmentTest).Fingerprint())
+
+	bare := def
+	bare.Environments = nil
+	assert.NotContains(t, string(bare.Canonical()), "environments")
+	assert.Equal(t, []string{
+		`risky: new alias "sk_live" for entity 41`,
+		`risky: new alias "sk_test" for entity 41`,
+	}, changeMessages(CheckCompatibility(bare, def)))
+	assert.Equal(t, []string{
+		`breaking: prefix "sk_live" of entity 41 removed`,
+		`breaking: prefix "sk_test" of entity 41 removed`,
+	}, changeMessages(CheckCompatibility(def, bare)))
+}
@@ -0,0 +1,69 @@
+package prefixed_uuids
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Expand renders an ID in its expanded, human-readable form, listing the
+// IDs of the components of multi and list types:
+//
+//	upc(user.AZXje_k_dRiprKK-aEY8fg,post.AZXje_k_dRiprKK-aEY8fg,comment.AZXje_k_dRiprKK-aEY8fg)
+//
+// Nested multi types are flattened. IDs of other entities are returned
+// unchanged.
+func (r *Registry) Expand(uuidStr string) (string, error) {
+	entity, pairs, err := r.DeserializeAny(uuidStr)
+	if err != nil {
+		return "", err
+	}
+	if !r.isComposite(entity) {
+		return uuidStr, nil
+	}
+
+	var b strings.Builder
+	b.WriteString(r.prefixes[entity])
+	b.WriteByte('(')
+	for i, pair := range pairs {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(r.Serialize(pair.Entity, pair.UUID))
+	}
+	b.WriteByte(')')
+	return b.String(), nil
+}
+
+// Compact parses the expanded form of an ID produced by Expand, or written
+// by hand, and returns the compact ID. Spaces around components are
+// ignored, and components may themselves be multi IDs of nested multi
+// types. IDs which are not expanded are validated and returned unchanged.
+func (r *Registry) Compact(expanded string) (string, error) {
+	open := strings.IndexByte(expanded, '(')
+	if open < 0 {
+		if _, _, err := r.DeserializeAny(expanded); err != nil {
+			return "", err
+		}
+		return expanded, nil
+	}
+	if !strings.HasSuffix(expanded, ")") {
+		return "", fmt.Errorf("%w: expanded id must end with ')'", ErrInvalidPrefixedUUIDFormat)
+	}
+	entity, ok := r.reverse[expanded[:open]]
+	if !ok {
+		return "", fmt.Errorf("%w", ErrUnknownPrefix)
+	}
+	if !r.isComposite(entity) {
+		return "", fmt.Errorf("%w", ErrNotMultiEntity)
+	}
+
+	var pairs []EntityUUID
+	for _, component := range strings.Split(expanded[open+1:len(expanded)-1], ",") {
+		_, componentPairs, err := r.DeserializeAny(strings.TrimSpace(component))
+		if err != nil {
+			return "", err
+		}
+		pairs = append(pairs, componentPairs...)
+	}
+	return r.SerializeMulti(entity, pairs...)
+}
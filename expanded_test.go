@@ -0,0 +1,59 @@
+package prefixed_uuids
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandAndCompact(t *testing.T) {
+	r := newNestedRegistry(t)
+	u := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+	user, post, comment := r.Serialize(User, u), r.Serialize(Post, u), r.Serialize(Comment, u)
+
+	compact, err := r.SerializeMulti(UserPostThenComment, EntityUUID{User, u}, EntityUUID{Post, u}, EntityUUID{Comment, u})
+	assert.NoError(t, err)
+	expanded, err := r.Expand(compact)
+	assert.NoError(t, err)
+	assert.Equal(t, "upc(user.AZXje_k_dRiprKK-aEY8fg,post.AZXje_k_dRiprKK-aEY8fg,comment.AZXje_k_dRiprKK-aEY8fg)", expanded)
+
+	parsed, err := r.Compact(expanded)
+	assert.NoError(t, err)
+	assert.Equal(t, compact, parsed)
+
+	// Hand written forms may use spaces and nested multi IDs.
+	up, err := r.Compact("up(" + user + ", " + post + ")")
+	assert.NoError(t, err)
+	parsed, err = r.Compact("upc( " + up + " , " + comment + " )")
+	assert.NoError(t, err)
+	assert.Equal(t, compact, parsed)
+
+	// Plain IDs are unchanged.
+	expanded, err = r.Expand(user)
+	assert.NoError(t, err)
+	assert.Equal(t, user, expanded)
+	parsed, err = r.Compact(user)
+	assert.NoError(t, err)
+	assert.Equal(t, user, parsed)
+
+	tests := []struct {
+		name  string
+		input string
+		err   error
+	}{
+		{"missing paren", "up(" + user + "," + post, ErrInvalidPrefixedUUIDFormat},
+		{"unknown prefix", "nope(" + user + "," + post + ")", ErrUnknownPrefix},
+		{"not a multi type", "user(" + user + ")", ErrNotMultiEntity},
+		{"wrong order", "up(" + post + "," + user + ")", ErrEntityOrderMismatch},
+		{"missing component", "up(" + user + ")", ErrUUIDCountMismatch},
+		{"bad component", "up(" + user + ",post.invalid!)", ErrInvalidUUIDBadBase64},
+		{"bad plain id", "user.invalid!", ErrInvalidUUIDBadBase64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := r.Compact(tt.input)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package prefixed_uuids
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const canonicalHeader = "prefixed_uuids registry v1"
+
+// Canonical returns the canonical text serialization of the definition.
+// Two definitions describing the same wire format produce byte-identical
+// output regardless of the order they were declared in, which makes it
+// suitable for hashing and for checking into source control:
+//
+//	prefixed_uuids registry v1
+//	separator .
+//	encoding base64url
+//	compression shared_prefix
+//	entity 1 user
+//	alias 1 usr
+//	multi 10 up 1 2
+//	multi 11 upc 1 2 3?
+//	list 20 posts 2 1 20
+//	union 30 2 4
+//	tenant_scoped 2
+//	environments 1
+//	secrets 1
+//	secret_checksum crc32
+func (d Definition) Canonical() []byte {
+	prefixes := slices.Clone(d.Prefixes)
+	sort.Slice(prefixes, func(i, j int) bool { return prefixes[i].Entity < prefixes[j].Entity })
+	aliases := slices.Clone(d.Aliases)
+	sort.Slice(aliases, func(i, j int) bool {
+		if aliases[i].Entity != aliases[j].Entity {
+			return aliases[i].Entity < aliases[j].Entity
+		}
+		return aliases[i].Prefix < aliases[j].Prefix
+	})
+	multi := slices.Clone(d.Multi)
+	sort.Slice(multi, func(i, j int) bool { return multi[i].Entity < multi[j].Entity })
+	lists := slices.Clone(d.Lists)
+	sort.Slice(lists, func(i, j int) bool { return lists[i].Entity < lists[j].Entity })
+	unions := slices.Clone(d.Unions)
+	sort.Slice(unions, func(i, j int) bool { return unions[i].Entity < unions[j].Entity })
+	namespaces := slices.Clone(d.Namespaces)
+	sort.Slice(namespaces, func(i, j int) bool { return namespaces[i].Entity < namespaces[j].Entity })
+
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, canonicalHeader)
+	fmt.Fprintf(&buf, "separator %s\n", d.Separator)
+	fmt.Fprintf(&buf, "encoding %s\n", d.Encoding)
+	if d.URNNamespace != "" {
+		fmt.Fprintf(&buf, "urn_namespace %s\n", strings.ToLower(d.URNNamespace))
+	}
+	if d.Compression != "" {
+		fmt.Fprintf(&buf, "compression %s\n", d.Compression)
+	}
+	for _, p := range prefixes {
+		fmt.Fprintf(&buf, "entity %d %s\n", p.Entity, p.Prefix)
+	}
+	for _, p := range aliases {
+		fmt.Fprintf(&buf, "alias %d %s\n", p.Entity, p.Prefix)
+	}
+	for _, m := range multi {
+		fmt.Fprintf(&buf, "multi %d %s %s\n", m.Entity, m.Prefix, formatComponents(m.Entities))
+	}
+	for _, l := range lists {
+		fmt.Fprintf(&buf, "list %d %s %d %d %d\n", l.Entity, l.Prefix, l.Component, l.Min, l.Max)
+	}
+	for _, u := range unions {
+		fmt.Fprintf(&buf, "union %d %s\n", u.Entity, formatComponents(u.Entities))
+	}
+	if len(d.TenantScoped) > 0 {
+		tenantScoped := slices.Clone(d.TenantScoped)
+		slices.Sort(tenantScoped)
+		fmt.Fprintf(&buf, "tenant_scoped %s\n", formatComponents(tenantScoped))
+	}
+	if len(d.Environments) > 0 {
+		envEntities := slices.Clone(d.Environments)
+		slices.Sort(envEntities)
+		fmt.Fprintf(&buf, "environments %s\n", formatComponents(envEntities))
+	}
+	if len(d.Secrets) > 0 {
+		secrets := slices.Clone(d.Secrets)
+		slices.Sort(secrets)
+		fmt.Fprintf(&buf, "secrets %s\n", formatComponents(secrets))
+	}
+	if d.SecretChecksum != "" {
+		fmt.Fprintf(&buf, "secret_checksum %s\n", d.SecretChecksum)
+	}
+	if len(namespaces) > 0 {
+		fmt.Fprintf(&buf, "derivation %s\n", d.Derivation)
+	}
+	for _, n := range namespaces {
+		fmt.Fprintf(&buf, "namespace %d %s\n", n.Entity, n.Namespace)
+	}
+	return buf.Bytes()
+}
+
+// Fingerprint returns a SHA-256 hash of the canonical serialization of the
+// definition, formatted as "sha256:<hex>".
+func (d Definition) Fingerprint() string {
+	sum := sha256.Sum256(d.Canonical())
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Fingerprint returns a deterministic hash of everything that affects the
+// IDs produced and accepted by the registry. Services sharing IDs can expose
+// it in health endpoints or compare it at startup to detect drift.
+func (r *Registry) Fingerprint() string {
+	return r.Definition().Fingerprint()
+}
+
+// VerifyFingerprint returns ErrFingerprintMismatch if the registry's
+// fingerprint differs from expected.
+func (r *Registry) VerifyFingerprint(expected string) error {
+	if actual := r.Fingerprint(); actual != expected {
+		return fmt.Errorf("%w: expected %s, got %s", ErrFingerprintMismatch, expected, actual)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package prefixed_uuids
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonical(t *testing.T) {
+	r := mustRegistry(t,
+		[]PrefixInfo{{Post, "post"}, {User, "usr"}, {User, "user"}},
+		[]MultiPrefixInfo{{UserPost, "up", []Entity{User, Post}}},
+	)
+	expected := strings.Join([]string{
+		"prefixed_uuids registry v1",
+		"separator .",
+		"encoding base64url",
+		"entity 1 user",
+		"entity 2 post",
+		"alias 1 usr",
+		"multi 10 up 1 2",
+		"",
+	}, "\n")
+	assert.Equal(t, expected, string(r.Definition().Canonical()))
+}
+
+func TestFingerprint(t *testing.T) {
+	a := mustRegistry(t,
+		[]PrefixInfo{{User, "user"}, {Post, "post"}},
+		[]MultiPrefixInfo{{UserPost, "up", []Entity{User, Post}}},
+	)
+	// Same definition declared in a different order.
+	b := mustRegistry(t,
+		[]PrefixInfo{{Post, "post"}, {User, "user"}},
+		[]MultiPrefixInfo{{UserPost, "up", []Entity{User, Post}}},
+	)
+	assert.Equal(t, a.Fingerprint(), b.Fingerprint())
+	assert.True(t, strings.HasPrefix(a.Fingerprint(), "sha256:"))
+	assert.NoError(t, b.VerifyFingerprint(a.Fingerprint()))
+
+	// Unsorted definitions hash the same as sorted ones.
+	def := a.Definition()
+	def.Prefixes[0], def.Prefixes[1] = def.Prefixes[1], def.Prefixes[0]
+	assert.Equal(t, a.Fingerprint(), def.Fingerprint())
+
+	reordered := mustRegistry(t,
+		[]PrefixInfo{{User, "user"}, {Post, "post"}},
+		[]MultiPrefixInfo{{UserPost, "up", []Entity{Post, User}}},
+	)
+	assert.NotEqual(t, a.Fingerprint(), reordered.Fingerprint())
+	assert.ErrorIs(t, reordered.VerifyFingerprint(a.Fingerprint()), ErrFingerprintMismatch)
+
+	renamed := mustRegistry(t,
+		[]PrefixInfo{{User, "usr"}, {Post, "post"}},
+		[]MultiPrefixInfo{{UserPost, "up", []Entity{User, Post}}},
+	)
+	assert.NotEqual(t, a.Fingerprint(), renamed.Fingerprint())
+
+	tilde := mustRegistry(t,
+		[]PrefixInfo{{User, "user"}, {Post, "post"}},
+		[]MultiPrefixInfo{{UserPost, "up", []Entity{User, Post}}},
+	)
+	_, err := tilde.WithSeparator("~")
+	assert.NoError(t, err)
+	assert.NotEqual(t, a.Fingerprint(), tilde.Fingerprint())
+
+	urn := mustRegistry(t,
+		[]PrefixInfo{{User, "user"}, {Post, "post"}},
+		[]MultiPrefixInfo{{UserPost, "up", []Entity{User, Post}}},
+	)
+	_, err = urn.WithURNNamespace("example")
+	assert.NoError(t, err)
+	assert.NotEqual(t, a.Fingerprint(), urn.Fingerprint())
+	assert.Contains(t, string(urn.Definition().Canonical()), "urn_namespace example\n")
+}
@@ -0,0 +1,167 @@
+package prefixed_uuids
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+// ListPrefixInfo describes a list type: a variable number of UUIDs of a
+// single component entity encoded under one prefix, e.g. a selection of
+// posts or a path of folders.
+type ListPrefixInfo struct {
+	Entity    Entity `json:"entity"`
+	Prefix    string `json:"prefix"`
+	Component Entity `json:"component"`
+	Min       int    `json:"min"`
+	Max       int    `json:"max"`
+}
+
+// WithLists registers list types. SerializeMulti packs any number of
+// component UUIDs between Min and Max into a list ID, and DeserializeList
+// returns them as a slice.
+func (r *Registry) WithLists(lists ...ListPrefixInfo) (*Registry, error) {
+	if r.encoding == EncodingTypeID {
+		return nil, fmt.Errorf("list types are not supported by typeid registries")
+	}
+	added := make([]ListPrefixInfo, 0, len(lists))
+	rollback := func() {
+		for _, info := range added {
+			delete(r.prefixes, info.Entity)
+			delete(r.reverse, info.Prefix)
+			delete(r.lists, info.Entity)
+		}
+	}
+
+	for _, info := range lists {
+		if err := r.checkNewPrefix(info.Entity, info.Prefix); err != nil {
+			rollback()
+			return nil, err
+		}
+		if info.Min < 1 || info.Max < info.Min {
+			rollback()
+			return nil, fmt.Errorf("list type must have 1 <= min <= max, got min %d and max %d", info.Min, info.Max)
+		}
+		if _, ok := r.prefixes[info.Component]; !ok || r.isComposite(info.Component) {
+			rollback()
+			return nil, fmt.Errorf("component entity %d is not registered in the registry", info.Component)
+		}
+		if err := r.checkPlainComponent(info.Component); err != nil {
+			rollback()
+			return nil, err
+		}
+
+		r.prefixes[info.Entity] = info.Prefix
+		r.reverse[info.Prefix] = info.Entity
+		r.lists[info.Entity] = info
+		added = append(added, info)
+	}
+
+	if isPayloadChar(r.separator) {
+		if err := r.checkFixedLengthAmbiguity(r.separator); err != nil {
+			rollback()
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// isComposite reports whether entity is a multi or list type.
+func (r *Registry) isComposite(entity Entity) bool {
+	_, multi := r.multi[entity]
+	_, list := r.lists[entity]
+	return multi || list
+}
+
+// checkPlainComponent rejects secret and tenant scoped entities as
+// components of multi, list and union types, which hold plain UUIDs.
+func (r *Registry) checkPlainComponent(entity Entity) error {
+	if r.secrets[entity] {
+		return fmt.Errorf("entity %d is secret and cannot be a component", entity)
+	}
+	if r.tenantScoped[entity] {
+		return fmt.Errorf("entity %d is tenant scoped and cannot be a component", entity)
+	}
+	return nil
+}
+
+// isComponent reports whether entity is a component of a registered multi,
+// list or union type.
+func (r *Registry) isComponent(entity Entity) bool {
+	for _, components := range r.multi {
+		for _, c := range components {
+			if e, _ := splitOptional(c); e == entity {
+				return true
+			}
+		}
+	}
+	for _, info := range r.lists {
+		if info.Component == entity {
+			return true
+		}
+	}
+	for _, members := range r.unions {
+		if slices.Contains(members, entity) {
+			return true
+		}
+	}
+	return false
+}
+
+// components returns the component entities expected for n UUIDs of the
+// multi or list type entity. Nested multi types are flattened.
+func (r *Registry) components(entity Entity, n int) ([]Entity, error) {
+	if _, ok := r.multi[entity]; ok {
+		components := r.flatComponents(entity)
+		if n != len(components) {
+			return nil, fmt.Errorf("%w: expected %d, got %d", ErrUUIDCountMismatch, len(components), n)
+		}
+		return components, nil
+	}
+	if list, ok := r.lists[entity]; ok {
+		if n < list.Min || n > list.Max {
+			return nil, fmt.Errorf("%w: expected between %d and %d, got %d", ErrUUIDCountMismatch, list.Min, list.Max, n)
+		}
+		components := make([]Entity, n)
+		for i := range components {
+			components[i] = list.Component
+		}
+		return components, nil
+	}
+	return nil, fmt.Errorf("%w", ErrNotMultiEntity)
+}
+
+// DeserializeList deserializes a list ID of entity into its component
+// UUIDs.
+func (r *Registry) DeserializeList(entity Entity, uuidStr string) ([]uuid.UUID, error) {
+	parsedEntity, payload, err := r.decodePayload(uuidStr)
+	if err != nil {
+		return nil, err
+	}
+	if parsedEntity != entity {
+		return nil, fmt.Errorf("%w", ErrEntityMismatch)
+	}
+	list, ok := r.lists[entity]
+	if !ok {
+		return nil, fmt.Errorf("%w", ErrNotListEntity)
+	}
+	if len(payload) == 0 || len(payload)%16 != 0 {
+		return nil, fmt.Errorf("%w", ErrInvalidUUIDFormat)
+	}
+	n := len(payload) / 16
+	if n < list.Min || n > list.Max {
+		return nil, fmt.Errorf("%w: expected between %d and %d, got %d", ErrUUIDCountMismatch, list.Min, list.Max, n)
+	}
+
+	uuids := make([]uuid.UUID, n)
+	for i := range uuids {
+		parsed, err := uuid.FromBytes(payload[i*16 : (i+1)*16])
+		if err != nil {
+			return nil, errors.Join(err, ErrInvalidUUIDFormat)
+		}
+		uuids[i] = parsed
+	}
+	return uuids, nil
+}
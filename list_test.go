@@ -0,0 +1,206 @@
+package prefixed_uuids
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	PostSelection Entity = 20
+	PostPair      Entity = 21
+)
+
+func newListRegistry(t *testing.T) *Registry {
+	t.Helper()
+	r := mustRegistry(t,
+		[]PrefixInfo{{User, "user"}, {Post, "post"}},
+		[]MultiPrefixInfo{{UserPost, "up", []Entity{User, Post}}},
+	)
+	r, err := r.WithLists(
+		ListPrefixInfo{PostSelection, "posts", Post, 1, 20},
+		ListPrefixInfo{PostPair, "pp", Post, 2, 2},
+	)
+	assert.NoError(t, err)
+	return r
+}
+
+func postUUIDs(n int) []uuid.UUID {
+	uuids := make([]uuid.UUID, n)
+	for i := range uuids {
+		uuids[i] = uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+		uuids[i][15] = byte(i)
+	}
+	return uuids
+}
+
+func postPairs(uuids []uuid.UUID) []EntityUUID {
+	pairs := make([]EntityUUID, len(uuids))
+	for i, u := range uuids {
+		pairs[i] = EntityUUID{Post, u}
+	}
+	return pairs
+}
+
+func TestListRoundTrip(t *testing.T) {
+	r := newListRegistry(t)
+
+	for _, n := range []int{1, 2, 7, 20} {
+		uuids := postUUIDs(n)
+		encoded, err := r.SerializeMulti(PostSelection, postPairs(uuids)...)
+		assert.NoError(t, err)
+		assert.Len(t, encoded, len("posts.")+base64withNoPadding.EncodedLen(16*n))
+
+		parsed, err := r.DeserializeList(PostSelection, encoded)
+		assert.NoError(t, err)
+		assert.Equal(t, uuids, parsed)
+
+		// Lists can also be read positionally.
+		targets := make([]uuid.UUID, n)
+		ptrs := make([]EntityUUIDPtr, n)
+		for i := range ptrs {
+			ptrs[i] = EntityUUIDPtr{Post, &targets[i]}
+		}
+		assert.NoError(t, r.DeserializeMulti(PostSelection, encoded, ptrs...))
+		assert.Equal(t, uuids, targets)
+	}
+}
+
+func TestListErrors(t *testing.T) {
+	r := newListRegistry(t)
+	u := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+
+	_, err := r.SerializeMulti(PostSelection)
+	assert.ErrorIs(t, err, ErrUUIDCountMismatch)
+	_, err = r.SerializeMulti(PostSelection, postPairs(postUUIDs(21))...)
+	assert.ErrorIs(t, err, ErrUUIDCountMismatch)
+	_, err = r.SerializeMulti(PostSelection, EntityUUID{Post, u}, EntityUUID{User, u})
+	assert.ErrorIs(t, err, ErrEntityOrderMismatch)
+
+	single, err := r.SerializeMulti(PostSelection, EntityUUID{Post, u})
+	assert.NoError(t, err)
+	_, err = r.DeserializeList(PostPair, single)
+	assert.ErrorIs(t, err, ErrEntityMismatch)
+
+	// A list ID with too few components for its bounds.
+	_, err = r.DeserializeList(PostPair, "pp"+single[len("posts"):])
+	assert.ErrorIs(t, err, ErrUUIDCountMismatch)
+
+	// Payloads which are not a multiple of 16 bytes.
+	_, err = r.DeserializeList(PostSelection, "posts.AZXje_k_dRiprKK-aEY8fgGV43v5")
+	assert.ErrorIs(t, err, ErrInvalidUUIDFormat)
+	_, err = r.DeserializeList(PostSelection, "posts.")
+	assert.ErrorIs(t, err, ErrInvalidUUIDFormat)
+
+	up, err := r.SerializeMulti(UserPost, EntityUUID{User, u}, EntityUUID{Post, u})
+	assert.NoError(t, err)
+	_, err = r.DeserializeList(UserPost, up)
+	assert.ErrorIs(t, err, ErrNotListEntity)
+}
+
+func TestListSingleIsNotPlain(t *testing.T) {
+	r := newListRegistry(t)
+	u := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+
+	// A list with one element has the payload of a plain ID.
+	single, err := r.SerializeMulti(PostSelection, EntityUUID{Post, u})
+	assert.NoError(t, err)
+	assert.Equal(t, "posts.AZXje_k_dRiprKK-aEY8fg", single)
+
+	_, _, err = r.DeserializeWithEntity(single)
+	assert.ErrorIs(t, err, ErrCompositeEntity)
+	_, err = r.Deserialize(PostSelection, single)
+	assert.ErrorIs(t, err, ErrCompositeEntity)
+	_, _, err = r.DeserializeOneOf(single, PostSelection, Post)
+	assert.ErrorIs(t, err, ErrCompositeEntity)
+
+	derived, err := r.WithNamespace(Post, uuid.NameSpaceDNS)
+	assert.NoError(t, err)
+	_, err = derived.DeriveFromParent(Post, single, "first")
+	assert.ErrorIs(t, err, ErrCompositeEntity)
+
+	uuids, err := r.DeserializeList(PostSelection, single)
+	assert.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{u}, uuids)
+}
+
+func TestWithListsValidation(t *testing.T) {
+	tests := []struct {
+		name          string
+		list          ListPrefixInfo
+		expectedError string
+	}{
+		{"null entity", ListPrefixInfo{NullEntity, "posts", Post, 1, 2}, "NullEntity"},
+		{"bad prefix", ListPrefixInfo{PostSelection, "Posts", Post, 1, 2}, "prefix must be in lowercase"},
+		{"duplicate entity", ListPrefixInfo{Post, "posts", Post, 1, 2}, "already registered"},
+		{"duplicate prefix", ListPrefixInfo{PostSelection, "post", Post, 1, 2}, "already registered"},
+		{"zero min", ListPrefixInfo{PostSelection, "posts", Post, 0, 2}, "min <= max"},
+		{"max below min", ListPrefixInfo{PostSelection, "posts", Post, 3, 2}, "min <= max"},
+		{"unregistered component", ListPrefixInfo{PostSelection, "posts", Comment, 1, 2}, "not registered"},
+		{"multi component", ListPrefixInfo{PostSelection, "posts", UserPost, 1, 2}, "not registered"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := mustRegistry(t,
+				[]PrefixInfo{{User, "user"}, {Post, "post"}},
+				[]MultiPrefixInfo{{UserPost, "up", []Entity{User, Post}}},
+			)
+			_, err := r.WithLists(ListPrefixInfo{PostPair, "pp", Post, 2, 2}, tt.list)
+			assert.ErrorContains(t, err, tt.expectedError)
+			// Nothing is registered when any list is invalid.
+			_, ok := r.reverse["pp"]
+			assert.False(t, ok)
+		})
+	}
+
+	typeid, err := mustRegistry(t, []PrefixInfo{{Post, "post"}}, nil).WithTypeID()
+	assert.NoError(t, err)
+	_, err = typeid.WithLists(ListPrefixInfo{PostSelection, "posts", Post, 1, 2})
+	assert.ErrorContains(t, err, "not supported")
+}
+
+func TestListWithPayloadCharSeparator(t *testing.T) {
+	r := mustRegistry(t, []PrefixInfo{{User, "user"}, {Post, "post"}}, nil)
+	r, err := r.WithSeparator("_")
+	assert.NoError(t, err)
+	r, err = r.WithLists(ListPrefixInfo{PostSelection, "posts", Post, 1, 5})
+	assert.NoError(t, err)
+
+	for n := 1; n <= 5; n++ {
+		uuids := postUUIDs(n)
+		encoded, err := r.SerializeMulti(PostSelection, postPairs(uuids)...)
+		assert.NoError(t, err)
+		parsed, err := r.DeserializeList(PostSelection, encoded)
+		assert.NoError(t, err)
+		assert.Equal(t, uuids, parsed)
+	}
+
+	// "posts_" followed by 20 characters and a 22 character payload could also
+	// be read as a "posts" ID with a 43 character (2 post) payload.
+	_, err = r.WithLists(ListPrefixInfo{Other, "posts_abcdefghijklmnopqrst", Post, 1, 1})
+	assert.ErrorIs(t, err, ErrInvalidSeparator)
+	_, ok := r.reverse["posts_abcdefghijklmnopqrst"]
+	assert.False(t, ok)
+}
+
+func TestListDefinition(t *testing.T) {
+	r := newListRegistry(t)
+	def := r.Definition()
+	assert.Equal(t, []PrefixInfo{{User, "user"}, {Post, "post"}}, def.Prefixes)
+	assert.Equal(t, []ListPrefixInfo{{PostSelection, "posts", Post, 1, 20}, {PostPair, "pp", Post, 2, 2}}, def.Lists)
+	assert.Contains(t, string(def.Canonical()), "list 20 posts 2 1 20\n")
+
+	widened := def
+	widened.Lists = []ListPrefixInfo{{PostSelection, "posts", Post, 1, 50}, {PostPair, "pp", Post, 2, 2}}
+	assert.Equal(t, []string{
+		`safe: list type 20 ("posts") bounds widened from 1..20 to 1..50`,
+	}, changeMessages(CheckCompatibility(def, widened)))
+
+	narrowed := def
+	narrowed.Lists = []ListPrefixInfo{{PostSelection, "posts", Post, 1, 10}, {PostPair, "pp", User, 2, 2}}
+	assert.Equal(t, []string{
+		`breaking: list type 20 ("posts") bounds narrowed from 1..20 to 1..10`,
+		`breaking: list type 21 ("pp") component changed from 2 to 1`,
+	}, changeMessages(CheckCompatibility(def, narrowed)))
+}
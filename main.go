@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/google/uuid"
 )
@@ -22,24 +23,37 @@ var (
 	ErrNotMultiEntity            = errors.New("entity is not a multi type")
 	ErrUUIDCountMismatch         = errors.New("number of uuids does not match multi type definition")
 	ErrEntityOrderMismatch       = errors.New("entity at position does not match multi type definition")
+	ErrFingerprintMismatch       = errors.New("registry fingerprint mismatch")
+	ErrInvalidURN                = errors.New("invalid urn")
+	ErrURNNamespaceNotSet        = errors.New("urn namespace is not set")
+	ErrDefaultRegistryNotSet     = errors.New("default registry is not set")
+	ErrDefaultRegistryAlreadySet = errors.New("default registry is already set")
+	ErrNamespaceNotSet           = errors.New("namespace is not set for entity")
+	ErrNotListEntity             = errors.New("entity is not a list type")
+	ErrCompositeEntity           = errors.New("entity is a multi or list type")
+	ErrTenantMismatch            = errors.New("tenant mismatch")
+	ErrNotTenantScoped           = errors.New("entity is not tenant scoped")
+	ErrEnvironmentMismatch       = errors.New("environment mismatch")
+	ErrInvalidSecret             = errors.New("invalid secret token")
+	ErrSecretMismatch            = errors.New("secret token does not match")
 )
 var (
 	NullEntity                 Entity = 0
 	base64withNoPadding               = base64.URLEncoding.WithPadding(base64.NoPadding)
 	prefixAllowedCharsRegex           = regexp.MustCompile(`^[a-z0-9_-]+$`)
-	separatorAllowedCharsRegex        = regexp.MustCompile(`^[\.~]$`)
+	separatorAllowedCharsRegex        = regexp.MustCompile(`^[\.~_-]$`)
 )
 
 type Entity int
 type PrefixInfo struct {
-	Entity Entity
-	Prefix string
+	Entity Entity `json:"entity"`
+	Prefix string `json:"prefix"`
 }
 
 type MultiPrefixInfo struct {
-	Entity   Entity
-	Prefix   string
-	Entities []Entity
+	Entity   Entity   `json:"entity"`
+	Prefix   string   `json:"prefix"`
+	Entities []Entity `json:"entities"`
 }
 
 type EntityUUID struct {
@@ -53,12 +67,42 @@ type EntityUUIDPtr struct {
 }
 
 type Registry struct {
-	prefixes  map[Entity]string
-	reverse   map[string]Entity
-	separator string
-	multi     map[Entity][]Entity
+	prefixes       map[Entity]string
+	reverse        map[string]Entity
+	separator      string
+	encoding       string
+	multi          map[Entity][]Entity
+	lists          map[Entity]ListPrefixInfo
+	unions         map[Entity][]Entity
+	urnNamespace   string
+	namespaces     map[Entity]uuid.UUID
+	derivation     Derivation
+	compression    string
+	tenantKey      []byte
+	tenantScoped   map[Entity]bool
+	environment    Environment
+	envEntities    map[Entity]bool
+	envPrefixes    map[string]Environment
+	bareEnvIDs     bool
+	secrets        map[Entity]bool
+	secretChecksum string
+	structs        sync.Map // multiStructKey -> multiStructFields
+	regexps        sync.Map // pattern -> *regexp.Regexp
+}
+
+// Codec is the set of Registry methods used to convert between UUIDs and
+// prefixed IDs. Code which accepts a Codec instead of a *Registry can be
+// tested with a double such as prefixedtest.Recorder.
+type Codec interface {
+	Serialize(entity Entity, uuid uuid.UUID) string
+	Deserialize(entity Entity, uuidStr string) (uuid.UUID, error)
+	DeserializeWithEntity(uuidStr string) (Entity, uuid.UUID, error)
+	SerializeMulti(entity Entity, pairs ...EntityUUID) (string, error)
+	DeserializeMulti(entity Entity, uuidStr string, targets ...EntityUUIDPtr) error
 }
 
+var _ Codec = (*Registry)(nil)
+
 func NewRegistry(prefixes []PrefixInfo) (*Registry, error) {
 	return NewRegistry2(prefixes, nil)
 }
@@ -68,11 +112,14 @@ func NewRegistry2(prefixes []PrefixInfo, multiPrefixes []MultiPrefixInfo) (*Regi
 		prefixes:  make(map[Entity]string, len(prefixes)),
 		reverse:   make(map[string]Entity, len(prefixes)),
 		separator: defaultSeparator,
+		encoding:  EncodingBase64URL,
 		multi:     make(map[Entity][]Entity),
+		lists:     make(map[Entity]ListPrefixInfo),
+		unions:    make(map[Entity][]Entity),
 	}
 	for _, prefix := range prefixes {
-		if prefix.Entity == NullEntity {
-			return nil, fmt.Errorf("entity cannot be NullEntity, use a non-zero value")
+		if err := checkEntity(prefix.Entity); err != nil {
+			return nil, err
 		}
 		if !prefixAllowedCharsRegex.MatchString(prefix.Prefix) {
 			return nil, fmt.Errorf("prefix must be in lowercase and contain only alphanumeric characters, underscores, and hyphens")
@@ -83,66 +130,163 @@ func NewRegistry2(prefixes []PrefixInfo, multiPrefixes []MultiPrefixInfo) (*Regi
 	}
 
 	for _, info := range multiPrefixes {
-		if info.Entity == NullEntity {
-			return nil, fmt.Errorf("entity cannot be NullEntity, use a non-zero value")
-		}
-		if !prefixAllowedCharsRegex.MatchString(info.Prefix) {
-			return nil, fmt.Errorf("prefix must be in lowercase and contain only alphanumeric characters, underscores, and hyphens")
+		if err := registry.addMulti(info); err != nil {
+			return nil, err
 		}
-		if _, exists := registry.prefixes[info.Entity]; exists {
-			return nil, fmt.Errorf("entity %d is already registered", info.Entity)
-		}
-		if _, exists := registry.reverse[info.Prefix]; exists {
-			return nil, fmt.Errorf("prefix %q is already registered", info.Prefix)
+	}
+
+	return registry, nil
+}
+
+// addMulti validates and registers a multi type.
+func (r *Registry) addMulti(info MultiPrefixInfo) error {
+	if r.encoding == EncodingTypeID {
+		return fmt.Errorf("multi types are not supported by typeid registries")
+	}
+	if err := r.checkNewPrefix(info.Entity, info.Prefix); err != nil {
+		return err
+	}
+	if len(info.Entities) < 2 {
+		return fmt.Errorf("multi type must have at least 2 component entities")
+	}
+	for _, c := range info.Entities {
+		e, optional := splitOptional(c)
+		_, ok := r.prefixes[e]
+		if _, union := r.unions[e]; !ok && !union {
+			return fmt.Errorf("component entity %d is not registered in the registry", e)
 		}
-		if len(info.Entities) < 2 {
-			return nil, fmt.Errorf("multi type must have at least 2 component entities")
+		if err := r.checkPlainComponent(e); err != nil {
+			return err
 		}
-		for _, e := range info.Entities {
-			if _, ok := registry.prefixes[e]; !ok {
-				return nil, fmt.Errorf("component entity %d is not registered in the registry", e)
-			}
+		if err := r.checkNestedComponent(e, optional); err != nil {
+			return err
 		}
+	}
+	if err := r.checkOptionalComponents(r.flatten(info.Entities)); err != nil {
+		return err
+	}
+
+	r.prefixes[info.Entity] = info.Prefix
+	r.reverse[info.Prefix] = info.Entity
+	r.multi[info.Entity] = info.Entities
+	return nil
+}
 
-		registry.prefixes[info.Entity] = info.Prefix
-		registry.reverse[info.Prefix] = info.Entity
-		registry.multi[info.Entity] = info.Entities
+// checkEntity rejects entity values which can't be registered: NullEntity,
+// and values with the bit Optional sets, which would be read as optional
+// components of multi types.
+func checkEntity(entity Entity) error {
+	if entity == NullEntity {
+		return fmt.Errorf("entity cannot be NullEntity, use a non-zero value")
+	}
+	if entity&optionalFlag != 0 {
+		return fmt.Errorf("entity %d is out of range, values must be below %d", entity, optionalFlag)
 	}
+	return nil
+}
 
-	return registry, nil
+// checkNewPrefix validates an entity and prefix which are about to be
+// registered as a composite type.
+func (r *Registry) checkNewPrefix(entity Entity, prefix string) error {
+	if err := checkEntity(entity); err != nil {
+		return err
+	}
+	if !prefixAllowedCharsRegex.MatchString(prefix) {
+		return fmt.Errorf("prefix must be in lowercase and contain only alphanumeric characters, underscores, and hyphens")
+	}
+	if _, exists := r.prefixes[entity]; exists {
+		return fmt.Errorf("entity %d is already registered", entity)
+	}
+	if _, exists := r.reverse[prefix]; exists {
+		return fmt.Errorf("prefix %q is already registered", prefix)
+	}
+	return nil
 }
 
 // WithSeparator sets a custom separator for the Registry.
-// Only '.' and '~' are allowed as separators since they are
-// not part of the base64url encoding alphabet and not encoded in URLs.
+// '.' and '~' are preferred since they are not part of the base64url
+// encoding alphabet and not encoded in URLs. '_' and '-' are also allowed,
+// in which case IDs are parsed by peeling the fixed-length payload off the
+// right, and registries where that would be ambiguous are rejected.
 func (r *Registry) WithSeparator(separator string) (*Registry, error) {
 	if !separatorAllowedCharsRegex.MatchString(separator) {
-		return nil, fmt.Errorf("%w: only '.' and '~' are allowed", ErrInvalidSeparator)
+		return nil, fmt.Errorf("%w: only '.', '~', '_' and '-' are allowed", ErrInvalidSeparator)
+	}
+	if r.encoding == EncodingTypeID && separator != typeIDSeparator {
+		return nil, fmt.Errorf("%w: typeid registries must use '_'", ErrInvalidSeparator)
+	}
+	if isPayloadChar(separator) {
+		if r.compression != "" {
+			return nil, fmt.Errorf("%w: '_' and '-' are not supported with compression", ErrInvalidSeparator)
+		}
+		if err := r.checkFixedLengthAmbiguity(separator); err != nil {
+			return nil, err
+		}
 	}
 	r.separator = separator
 	return r, nil
 }
 
+// Serialize returns the prefixed ID of uuid. It must not be used for secret
+// or tenant scoped entities, whose IDs are created with GenerateSecret and
+// SerializeForTenant.
 func (r *Registry) Serialize(entity Entity, uuid uuid.UUID) string {
 	// MarshalBinary never returns an error
 	uuidBytes, _ := uuid.MarshalBinary()
-	return fmt.Sprintf("%s%s%s", r.prefixes[entity], r.separator, base64withNoPadding.EncodeToString(uuidBytes))
+	return fmt.Sprintf("%s%s%s", r.serializePrefix(entity), r.separator, r.encode(uuidBytes))
 }
 
-func (r *Registry) decodePayload(uuidStr string) (Entity, []byte, error) {
+// encode encodes a payload using the registry's encoding.
+func (r *Registry) encode(payload []byte) string {
+	if r.encoding == EncodingTypeID {
+		return encodeTypeIDSuffix(payload)
+	}
+	return base64withNoPadding.EncodeToString(payload)
+}
+
+// decode decodes a payload using the registry's encoding.
+func (r *Registry) decode(encoded string) ([]byte, error) {
+	if r.encoding == EncodingTypeID {
+		return decodeTypeIDSuffix(encoded)
+	}
+	payload, err := base64withNoPadding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.Join(err, ErrInvalidUUIDBadBase64)
+	}
+	return payload, nil
+}
+
+// splitID splits a prefixed ID into its prefix and encoded payload.
+func (r *Registry) splitID(uuidStr string) (string, string, error) {
+	if r.encoding == EncodingTypeID {
+		return splitTypeID(uuidStr)
+	}
+	if isPayloadChar(r.separator) {
+		return r.splitFixedLength(uuidStr)
+	}
 	parts := strings.Split(uuidStr, r.separator)
 	if len(parts) != 2 {
-		return NullEntity, nil, fmt.Errorf("%w", ErrInvalidPrefixedUUIDFormat)
+		return "", "", fmt.Errorf("%w", ErrInvalidPrefixedUUIDFormat)
+	}
+	return parts[0], parts[1], nil
+}
+
+func (r *Registry) decodePayload(uuidStr string) (Entity, []byte, error) {
+	prefix, encoded, err := r.splitID(uuidStr)
+	if err != nil {
+		return NullEntity, nil, err
 	}
-	prefix := parts[0]
 	parsedEntity, ok := r.reverse[prefix]
 	if !ok {
 		return NullEntity, nil, fmt.Errorf("%w", ErrUnknownPrefix)
 	}
+	if err := r.checkEnvironment(prefix); err != nil {
+		return NullEntity, nil, err
+	}
 
-	payload, err := base64withNoPadding.DecodeString(parts[1])
+	payload, err := r.decode(encoded)
 	if err != nil {
-		return NullEntity, nil, errors.Join(err, ErrInvalidUUIDBadBase64)
+		return NullEntity, nil, err
 	}
 	return parsedEntity, payload, nil
 }
@@ -153,6 +297,10 @@ func (r *Registry) DeserializeWithEntity(uuidStr string) (Entity, uuid.UUID, err
 		return NullEntity, uuid.Nil, err
 	}
 
+	if err := r.checkPlainEntity(parsedEntity); err != nil {
+		return NullEntity, uuid.Nil, err
+	}
+
 	parsedUUID, err := uuid.FromBytes(payload)
 	if err != nil {
 		return NullEntity, uuid.Nil, errors.Join(err, ErrInvalidUUIDFormat)
@@ -160,6 +308,23 @@ func (r *Registry) DeserializeWithEntity(uuidStr string) (Entity, uuid.UUID, err
 	return parsedEntity, parsedUUID, nil
 }
 
+// checkPlainEntity rejects IDs of entities which can't be parsed on their
+// own: secret tokens must be checked with VerifySecret, tenant scoped IDs
+// with DeserializeForTenant and multi and list IDs, which may hold a single
+// UUID, with DeserializeMulti or DeserializeList.
+func (r *Registry) checkPlainEntity(entity Entity) error {
+	if r.isComposite(entity) {
+		return fmt.Errorf("%w: %w: %q ids hold several uuids, use DeserializeMulti or DeserializeList", ErrInvalidUUIDFormat, ErrCompositeEntity, r.prefixes[entity])
+	}
+	if r.secrets[entity] {
+		return fmt.Errorf("%w: %q ids are secret tokens, use VerifySecret", ErrInvalidSecret, r.prefixes[entity])
+	}
+	if r.tenantScoped[entity] {
+		return fmt.Errorf("%w: %q ids are tenant scoped, use DeserializeForTenant", ErrTenantMismatch, r.prefixes[entity])
+	}
+	return nil
+}
+
 func (r *Registry) Deserialize(entity Entity, uuidStr string) (uuid.UUID, error) {
 	parsedEntity, parsedUUID, err := r.DeserializeWithEntity(uuidStr)
 	if err != nil {
@@ -174,61 +339,97 @@ func (r *Registry) Deserialize(entity Entity, uuidStr string) (uuid.UUID, error)
 }
 
 func (r *Registry) SerializeMulti(entity Entity, pairs ...EntityUUID) (string, error) {
-	components, ok := r.multi[entity]
-	if !ok {
-		return "", fmt.Errorf("%w", ErrNotMultiEntity)
+	if components := r.flatComponents(entity); optionalCount(components) > 0 {
+		return r.serializeOptionalMulti(entity, components, pairs)
 	}
-	if len(pairs) != len(components) {
-		return "", fmt.Errorf("%w: expected %d, got %d", ErrUUIDCountMismatch, len(components), len(pairs))
+	components, err := r.components(entity, len(pairs))
+	if err != nil {
+		return "", err
 	}
 
 	buf := make([]byte, 0, len(components)*16)
 	for i, pair := range pairs {
-		if pair.Entity != components[i] {
+		var ok bool
+		if buf, ok = r.appendComponent(buf, components[i], pair); !ok {
 			return "", fmt.Errorf("%w: position %d expected entity %d, got %d", ErrEntityOrderMismatch, i, components[i], pair.Entity)
 		}
-		uuidBytes, _ := pair.UUID.MarshalBinary()
-		buf = append(buf, uuidBytes...)
 	}
+	buf = r.compress(entity, components, buf)
 
-	return fmt.Sprintf("%s%s%s", r.prefixes[entity], r.separator, base64withNoPadding.EncodeToString(buf)), nil
+	return fmt.Sprintf("%s%s%s", r.prefixes[entity], r.separator, r.encode(buf)), nil
 }
 
 func (r *Registry) DeserializeMulti(entity Entity, uuidStr string, targets ...EntityUUIDPtr) error {
+	_, err := r.deserializeMulti(entity, uuidStr, targets)
+	return err
+}
+
+// deserializeMulti deserializes a multi or list type into targets and
+// reports which of them were present in the ID.
+func (r *Registry) deserializeMulti(entity Entity, uuidStr string, targets []EntityUUIDPtr) ([]bool, error) {
 	parsedEntity, payload, err := r.decodePayload(uuidStr)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if parsedEntity != entity {
-		return fmt.Errorf("%w", ErrEntityMismatch)
+		return nil, fmt.Errorf("%w", ErrEntityMismatch)
 	}
 
-	components, ok := r.multi[entity]
-	if !ok {
-		return fmt.Errorf("%w", ErrNotMultiEntity)
-	}
-	if len(targets) != len(components) {
-		return fmt.Errorf("%w: expected %d, got %d", ErrUUIDCountMismatch, len(components), len(targets))
+	components, err := r.components(entity, len(targets))
+	if err != nil {
+		return nil, err
 	}
 	for i, target := range targets {
-		if target.Entity != components[i] {
-			return fmt.Errorf("%w: position %d expected entity %d, got %d", ErrEntityOrderMismatch, i, components[i], target.Entity)
+		if component, _ := splitOptional(components[i]); target.Entity != component && !r.accepts(component, target.Entity) {
+			return nil, fmt.Errorf("%w: position %d expected entity %d, got %d", ErrEntityOrderMismatch, i, component, target.Entity)
 		}
 	}
 
-	expectedLen := len(components) * 16
-	if len(payload) != expectedLen {
-		return fmt.Errorf("%w", ErrInvalidUUIDFormat)
+	values, err := r.decodeComponents(entity, components, payload)
+	if err != nil {
+		return nil, err
 	}
 
+	present := make([]bool, len(targets))
 	for i, target := range targets {
-		chunk := payload[i*16 : (i+1)*16]
-		parsed, err := uuid.FromBytes(chunk)
-		if err != nil {
-			return errors.Join(err, ErrInvalidUUIDFormat)
+		if values[i].Entity == NullEntity {
+			continue
 		}
-		*target.UUID = parsed
+		// A union component read into a target of one of its entities
+		// must hold that entity.
+		if component, _ := splitOptional(components[i]); target.Entity != component && target.Entity != values[i].Entity {
+			return nil, fmt.Errorf("%w: position %d holds entity %d, not %d", ErrEntityMismatch, i, values[i].Entity, target.Entity)
+		}
+		*target.UUID = values[i].UUID
+		present[i] = true
 	}
 
-	return nil
+	return present, nil
+}
+
+// decodeComponents decodes the payload of entity, a multi or list type, with
+// the given components. Absent optional components are returned as
+// NullEntity.
+func (r *Registry) decodeComponents(entity Entity, components []Entity, payload []byte) ([]EntityUUID, error) {
+	payload, err := r.decompress(entity, components, payload)
+	if err != nil {
+		return nil, err
+	}
+	present, payload, err := readBitmap(components, payload)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]EntityUUID, len(components))
+	for i, c := range components {
+		if !present[i] {
+			continue
+		}
+		if values[i], payload, err = r.readComponent(c, payload); err != nil {
+			return nil, err
+		}
+	}
+	if len(payload) != 0 {
+		return nil, fmt.Errorf("%w", ErrInvalidUUIDFormat)
+	}
+	return values, nil
 }
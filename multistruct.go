@@ -0,0 +1,194 @@
+package prefixed_uuids
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/google/uuid"
+)
+
+// multiStructTag is the struct tag naming the prefix of the component a
+// field holds, e.g.
+//
+//	type UserPostComment struct {
+//		User    uuid.UUID  `pid:"user"`
+//		Post    uuid.UUID  `pid:"post"`
+//		Comment *uuid.UUID `pid:"comment"`
+//	}
+const multiStructTag = "pid"
+
+var (
+	uuidType    = reflect.TypeOf(uuid.UUID{})
+	uuidPtrType = reflect.TypeOf((*uuid.UUID)(nil))
+)
+
+// multiStructKey identifies the cached field mapping of a struct type for a
+// multi type.
+type multiStructKey struct {
+	entity Entity
+	typ    reflect.Type
+}
+
+// multiStructFields holds the index of the struct field holding each
+// component of a multi type.
+type multiStructFields []int
+
+// WithMultiStruct validates that the fields of the struct v, tagged with
+// the prefixes of the components of the multi type entity, cover every
+// component, and caches the mapping for MarshalMulti and UnmarshalMulti.
+// Registering struct types is optional, but reports mistakes at startup
+// rather than on first use.
+func (r *Registry) WithMultiStruct(entity Entity, v any) (*Registry, error) {
+	typ := reflect.TypeOf(v)
+	if typ != nil && typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if _, err := r.multiStruct(entity, typ); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// multiStruct returns the field mapping of the struct type typ for the
+// multi type entity, computing and caching it on first use.
+func (r *Registry) multiStruct(entity Entity, typ reflect.Type) (multiStructFields, error) {
+	key := multiStructKey{entity, typ}
+	if fields, ok := r.structs.Load(key); ok {
+		return fields.(multiStructFields), nil
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("multi struct must be a struct or a pointer to a struct, got %v", typ)
+	}
+	if _, ok := r.multi[entity]; !ok {
+		return nil, fmt.Errorf("%w", ErrNotMultiEntity)
+	}
+	components := r.flatComponents(entity)
+
+	type taggedField struct {
+		index  int
+		entity Entity
+	}
+	var tagged []taggedField
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		prefix, ok := field.Tag.Lookup(multiStructTag)
+		if !ok {
+			continue
+		}
+		fieldEntity, ok := r.reverse[prefix]
+		if !ok || !field.IsExported() {
+			return nil, fmt.Errorf("field %s.%s: prefix %q is not registered or the field is not exported", typ.Name(), field.Name, prefix)
+		}
+		tagged = append(tagged, taggedField{i, fieldEntity})
+	}
+
+	// Fields are matched to components by entity, in field order when a
+	// multi type has several components of the same entity.
+	fields := make(multiStructFields, len(components))
+	used := make([]bool, len(tagged))
+	for i, c := range components {
+		component, optional := splitOptional(c)
+		if _, union := r.unions[component]; union {
+			return nil, fmt.Errorf("component %d of multi type %d is a union, which is not supported by multi structs", i, entity)
+		}
+		found := false
+		for j, t := range tagged {
+			if used[j] || t.entity != component {
+				continue
+			}
+			field := typ.Field(t.index)
+			want := uuidType
+			if optional {
+				want = uuidPtrType
+			}
+			if field.Type != want {
+				return nil, fmt.Errorf("field %s.%s holding component %d must be of type %v", typ.Name(), field.Name, i, want)
+			}
+			fields[i], used[j], found = t.index, true, true
+			break
+		}
+		if !found {
+			return nil, fmt.Errorf("struct %s has no field tagged %s:%q for component %d of multi type %d", typ.Name(), multiStructTag, r.prefixes[component], i, entity)
+		}
+	}
+	for j, t := range tagged {
+		if !used[j] {
+			return nil, fmt.Errorf("field %s.%s does not match a component of multi type %d", typ.Name(), typ.Field(t.index).Name, entity)
+		}
+	}
+
+	r.structs.Store(key, fields)
+	return fields, nil
+}
+
+// MarshalMulti serializes the multi type entity from the fields of the
+// struct v, which are mapped to components by their pid tags. Optional
+// components are held in *uuid.UUID fields and left out when nil.
+func (r *Registry) MarshalMulti(entity Entity, v any) (string, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer {
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return "", fmt.Errorf("multi struct must be a struct or a pointer to a struct, got %T", v)
+	}
+	fields, err := r.multiStruct(entity, rv.Type())
+	if err != nil {
+		return "", err
+	}
+
+	components := r.flatComponents(entity)
+	pairs := make([]EntityUUID, 0, len(fields))
+	for i, index := range fields {
+		component, optional := splitOptional(components[i])
+		field := rv.Field(index)
+		if !optional {
+			pairs = append(pairs, EntityUUID{component, field.Interface().(uuid.UUID)})
+			continue
+		}
+		if !field.IsNil() {
+			pairs = append(pairs, EntityUUID{component, *field.Interface().(*uuid.UUID)})
+		}
+	}
+	return r.SerializeMulti(entity, pairs...)
+}
+
+// UnmarshalMulti deserializes the multi type entity into the fields of the
+// struct pointed to by v. Fields of absent optional components are set to
+// nil.
+func (r *Registry) UnmarshalMulti(entity Entity, uuidStr string, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("multi struct must be a non-nil pointer to a struct, got %T", v)
+	}
+	rv = rv.Elem()
+	fields, err := r.multiStruct(entity, rv.Type())
+	if err != nil {
+		return err
+	}
+
+	components := r.flatComponents(entity)
+	values := make([]uuid.UUID, len(fields))
+	targets := make([]EntityUUIDPtr, len(fields))
+	for i := range targets {
+		component, _ := splitOptional(components[i])
+		targets[i] = EntityUUIDPtr{component, &values[i]}
+	}
+	present, err := r.deserializeMulti(entity, uuidStr, targets)
+	if err != nil {
+		return err
+	}
+
+	for i, index := range fields {
+		field := rv.Field(index)
+		switch {
+		case field.Type() == uuidType:
+			field.Set(reflect.ValueOf(values[i]))
+		case present[i]:
+			field.Set(reflect.ValueOf(&values[i]))
+		default:
+			field.SetZero()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package prefixed_uuids
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type userPostKey struct {
+	Post uuid.UUID `pid:"post"`
+	User uuid.UUID `pid:"user"`
+	Note string
+}
+
+type userPostCommentKey struct {
+	User    uuid.UUID  `pid:"user"`
+	Post    uuid.UUID  `pid:"post"`
+	Comment *uuid.UUID `pid:"comment"`
+}
+
+func TestMultiStructRoundTrip(t *testing.T) {
+	r := newOptionalRegistry(t)
+	userID := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+	postID := uuid.MustParse("0195e37c-1a2b-7c3d-8e4f-5a6b7c8d9e0f")
+	commentID := uuid.MustParse("0195e37d-2b3c-7d4e-9f5a-6b7c8d9e0f1a")
+
+	// Field order doesn't matter, only the tags.
+	encoded, err := r.MarshalMulti(UserPost, userPostKey{Post: postID, User: userID})
+	assert.NoError(t, err)
+	expected, err := r.SerializeMulti(UserPost, EntityUUID{User, userID}, EntityUUID{Post, postID})
+	assert.NoError(t, err)
+	assert.Equal(t, expected, encoded)
+
+	var key userPostKey
+	assert.NoError(t, r.UnmarshalMulti(UserPost, encoded, &key))
+	assert.Equal(t, userPostKey{Post: postID, User: userID}, key)
+
+	for _, comment := range []*uuid.UUID{&commentID, nil} {
+		encoded, err := r.MarshalMulti(UserPostMaybeComment, &userPostCommentKey{userID, postID, comment})
+		assert.NoError(t, err)
+
+		parsed := userPostCommentKey{Comment: &uuid.Max}
+		assert.NoError(t, r.UnmarshalMulti(UserPostMaybeComment, encoded, &parsed))
+		assert.Equal(t, userPostCommentKey{userID, postID, comment}, parsed)
+	}
+}
+
+func TestMultiStructRepeatedEntity(t *testing.T) {
+	const Follow Entity = 23
+	r := mustRegistry(t, []PrefixInfo{{User, "user"}}, []MultiPrefixInfo{{Follow, "follow", []Entity{User, User}}})
+	follower := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+	followee := uuid.MustParse("0195e37c-1a2b-7c3d-8e4f-5a6b7c8d9e0f")
+
+	type followKey struct {
+		Follower uuid.UUID `pid:"user"`
+		Followee uuid.UUID `pid:"user"`
+	}
+	encoded, err := r.MarshalMulti(Follow, followKey{follower, followee})
+	assert.NoError(t, err)
+	var targetFollower, targetFollowee uuid.UUID
+	assert.NoError(t, r.DeserializeMulti(Follow, encoded, EntityUUIDPtr{User, &targetFollower}, EntityUUIDPtr{User, &targetFollowee}))
+	assert.Equal(t, []uuid.UUID{follower, followee}, []uuid.UUID{targetFollower, targetFollowee})
+}
+
+func TestWithMultiStructValidation(t *testing.T) {
+	type missing struct {
+		User uuid.UUID `pid:"user"`
+	}
+	type extra struct {
+		User    uuid.UUID `pid:"user"`
+		Post    uuid.UUID `pid:"post"`
+		Comment uuid.UUID `pid:"comment"`
+	}
+	type unknownPrefix struct {
+		User uuid.UUID `pid:"usr"`
+		Post uuid.UUID `pid:"post"`
+	}
+	type unexported struct {
+		user uuid.UUID `pid:"user"`
+		Post uuid.UUID `pid:"post"`
+	}
+	type wrongType struct {
+		User string    `pid:"user"`
+		Post uuid.UUID `pid:"post"`
+	}
+	type requiredOptional struct {
+		User    uuid.UUID `pid:"user"`
+		Post    uuid.UUID `pid:"post"`
+		Comment uuid.UUID `pid:"comment"`
+	}
+
+	tests := []struct {
+		name          string
+		entity        Entity
+		v             any
+		expectedError string
+	}{
+		{"missing component", UserPost, missing{}, `no field tagged pid:"post" for component 1`},
+		{"extra field", UserPost, extra{}, "field extra.Comment does not match a component"},
+		{"unknown prefix", UserPost, unknownPrefix{}, `prefix "usr" is not registered`},
+		{"unexported field", UserPost, unexported{}, "not exported"},
+		{"wrong type", UserPost, wrongType{}, "must be of type uuid.UUID"},
+		{"optional needs pointer", UserPostMaybeComment, requiredOptional{}, "must be of type *uuid.UUID"},
+		{"not a struct", UserPost, "user", "must be a struct"},
+		{"not a multi type", User, &userPostKey{}, ErrNotMultiEntity.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newOptionalRegistry(t)
+			_, err := r.WithMultiStruct(tt.entity, tt.v)
+			assert.ErrorContains(t, err, tt.expectedError)
+		})
+	}
+
+	r := newOptionalRegistry(t)
+	_, err := r.WithMultiStruct(UserPost, &userPostKey{})
+	assert.NoError(t, err)
+	_, ok := r.structs.Load(multiStructKey{UserPost, reflect.TypeOf(userPostKey{})})
+	assert.True(t, ok)
+	var key userPostKey
+	assert.Error(t, r.UnmarshalMulti(UserPost, "up.invalid", key))
+	assert.ErrorIs(t, r.UnmarshalMulti(UserPost, "up.invalid!", &key), ErrInvalidUUIDBadBase64)
+}
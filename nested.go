@@ -0,0 +1,112 @@
+package prefixed_uuids
+
+import "fmt"
+
+// checkNestedComponent validates a multi type component which is itself a
+// multi or list type. Nested multi types must have a fixed length, so they
+// can't be optional or have optional components, and lists can't be nested.
+func (r *Registry) checkNestedComponent(component Entity, optional bool) error {
+	if _, list := r.lists[component]; list {
+		return fmt.Errorf("list type %d cannot be a multi type component", component)
+	}
+	if _, nested := r.multi[component]; !nested {
+		return nil
+	}
+	if optional {
+		return fmt.Errorf("nested multi type %d cannot be optional", component)
+	}
+	if optionalCount(r.flatComponents(component)) > 0 {
+		return fmt.Errorf("nested multi type %d cannot have optional components", component)
+	}
+	return nil
+}
+
+// flatten replaces nested multi types in components with their own
+// components, recursively.
+func (r *Registry) flatten(components []Entity) []Entity {
+	flat := make([]Entity, 0, len(components))
+	for _, c := range components {
+		if nested, ok := r.multi[c]; ok {
+			flat = append(flat, r.flatten(nested)...)
+			continue
+		}
+		flat = append(flat, c)
+	}
+	return flat
+}
+
+// flatComponents returns the flattened components of the multi type
+// entity. A multi type with nested multi types is encoded exactly like a
+// multi type declared with the flattened components, so SerializeMulti,
+// DeserializeMulti and DeserializeMultiEntities work with the flattened
+// components.
+func (r *Registry) flatComponents(entity Entity) []Entity {
+	return r.flatten(r.multi[entity])
+}
+
+// Flatten builds an ID of the multi type entity from the IDs of its
+// components, e.g. a "upc" ID from a "up" and a "comment" ID when UserPost
+// is nested in UserPostComment. Optional components may be left out.
+func (r *Registry) Flatten(entity Entity, ids ...string) (string, error) {
+	var pairs []EntityUUID
+	for _, id := range ids {
+		idEntity, _, err := r.decodePayload(id)
+		if err != nil {
+			return "", err
+		}
+		if _, nested := r.multi[idEntity]; nested {
+			leaves, err := r.DeserializeMultiEntities(idEntity, id)
+			if err != nil {
+				return "", err
+			}
+			pairs = append(pairs, leaves...)
+			continue
+		}
+		_, parsed, err := r.DeserializeWithEntity(id)
+		if err != nil {
+			return "", err
+		}
+		pairs = append(pairs, EntityUUID{idEntity, parsed})
+	}
+	return r.SerializeMulti(entity, pairs...)
+}
+
+// Unflatten splits an ID of the multi type entity into the IDs of its
+// components, the inverse of Flatten. Nested multi types are returned as
+// their own multi IDs, and absent optional components are left out.
+func (r *Registry) Unflatten(entity Entity, uuidStr string) ([]string, error) {
+	parsedEntity, payload, err := r.decodePayload(uuidStr)
+	if err != nil {
+		return nil, err
+	}
+	if parsedEntity != entity {
+		return nil, fmt.Errorf("%w", ErrEntityMismatch)
+	}
+	components, ok := r.multi[entity]
+	if !ok {
+		return nil, fmt.Errorf("%w", ErrNotMultiEntity)
+	}
+	values, err := r.decodeComponents(entity, r.flatComponents(entity), payload)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(components))
+	for _, c := range components {
+		if _, nested := r.multi[c]; nested {
+			n := len(r.flatComponents(c))
+			id, err := r.SerializeMulti(c, values[:n]...)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+			values = values[n:]
+			continue
+		}
+		if values[0].Entity != NullEntity {
+			ids = append(ids, r.Serialize(values[0].Entity, values[0].UUID))
+		}
+		values = values[1:]
+	}
+	return ids, nil
+}
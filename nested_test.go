@@ -0,0 +1,94 @@
+package prefixed_uuids
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	UserPostThenComment Entity = 24
+	ThreadReply         Entity = 25
+)
+
+func newNestedRegistry(t *testing.T) *Registry {
+	t.Helper()
+	return mustRegistry(t,
+		[]PrefixInfo{{User, "user"}, {Post, "post"}, {Comment, "comment"}},
+		[]MultiPrefixInfo{
+			{UserPost, "up", []Entity{User, Post}},
+			{UserPostThenComment, "upc", []Entity{UserPost, Comment}},
+			{ThreadReply, "reply", []Entity{UserPostThenComment, User, Optional(Comment)}},
+		},
+	)
+}
+
+func TestNestedRoundTrip(t *testing.T) {
+	r := newNestedRegistry(t)
+	userID := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+	postID := uuid.MustParse("0195e37c-1a2b-7c3d-8e4f-5a6b7c8d9e0f")
+	commentID := uuid.MustParse("0195e37d-2b3c-7d4e-9f5a-6b7c8d9e0f1a")
+
+	// Nested multi types take the flattened components.
+	encoded, err := r.SerializeMulti(UserPostThenComment,
+		EntityUUID{User, userID}, EntityUUID{Post, postID}, EntityUUID{Comment, commentID})
+	assert.NoError(t, err)
+	assert.Len(t, encoded, len("upc.")+base64withNoPadding.EncodedLen(48))
+
+	var user, post, comment uuid.UUID
+	assert.NoError(t, r.DeserializeMulti(UserPostThenComment, encoded,
+		EntityUUIDPtr{User, &user}, EntityUUIDPtr{Post, &post}, EntityUUIDPtr{Comment, &comment}))
+	assert.Equal(t, []uuid.UUID{userID, postID, commentID}, []uuid.UUID{user, post, comment})
+
+	up, err := r.SerializeMulti(UserPost, EntityUUID{User, userID}, EntityUUID{Post, postID})
+	assert.NoError(t, err)
+	ids, err := r.Unflatten(UserPostThenComment, encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{up, r.Serialize(Comment, commentID)}, ids)
+
+	flattened, err := r.Flatten(UserPostThenComment, ids...)
+	assert.NoError(t, err)
+	assert.Equal(t, encoded, flattened)
+
+	// Two levels of nesting, with an absent optional component.
+	reply, err := r.Flatten(ThreadReply, encoded, r.Serialize(User, userID))
+	assert.NoError(t, err)
+	leaves, err := r.DeserializeMultiEntities(ThreadReply, reply)
+	assert.NoError(t, err)
+	assert.Equal(t, []EntityUUID{{User, userID}, {Post, postID}, {Comment, commentID}, {User, userID}}, leaves)
+	ids, err = r.Unflatten(ThreadReply, reply)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{encoded, r.Serialize(User, userID)}, ids)
+}
+
+func TestNestedErrors(t *testing.T) {
+	r := newNestedRegistry(t)
+	u := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+
+	_, err := r.Flatten(UserPostThenComment, r.Serialize(Comment, u), r.Serialize(User, u), r.Serialize(Post, u))
+	assert.ErrorIs(t, err, ErrEntityOrderMismatch)
+	_, err = r.Flatten(UserPostThenComment, "unknown.AZXje_k_dRiprKK-aEY8fg")
+	assert.ErrorIs(t, err, ErrUnknownPrefix)
+	_, err = r.Unflatten(UserPostThenComment, r.Serialize(User, u))
+	assert.ErrorIs(t, err, ErrEntityMismatch)
+	_, err = r.Unflatten(User, r.Serialize(User, u))
+	assert.ErrorIs(t, err, ErrNotMultiEntity)
+
+	prefixes := []PrefixInfo{{User, "user"}, {Post, "post"}, {Comment, "comment"}}
+	_, err = NewRegistry2(prefixes, []MultiPrefixInfo{
+		{UserPost, "up", []Entity{User, Post}},
+		{UserPostThenComment, "upc", []Entity{Optional(UserPost), Comment}},
+	})
+	assert.ErrorContains(t, err, "nested multi type 10 cannot be optional")
+	_, err = NewRegistry2(prefixes, []MultiPrefixInfo{
+		{UserPost, "up", []Entity{User, Optional(Post)}},
+		{UserPostThenComment, "upc", []Entity{UserPost, Comment}},
+	})
+	assert.ErrorContains(t, err, "nested multi type 10 cannot have optional components")
+
+	lists, err := mustRegistry(t, prefixes, nil).WithLists(ListPrefixInfo{PostSelection, "posts", Post, 1, 3})
+	assert.NoError(t, err)
+	_, err = lists.WithMulti(MultiPrefixInfo{UserPost, "up", []Entity{User, PostSelection}})
+	assert.ErrorContains(t, err, "list type 20 cannot be a multi type component")
+}
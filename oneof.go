@@ -0,0 +1,57 @@
+package prefixed_uuids
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// DeserializeOneOf deserializes an ID of any of the given entities, e.g. an
+// endpoint accepting user, user_v2 and user_v3 IDs, and returns the entity
+// it belongs to. Unions registered with WithUnions can be passed to accept
+// all of their entities. IDs of other entities are rejected with
+// ErrEntityMismatch, listing the accepted prefixes.
+func (r *Registry) DeserializeOneOf(uuidStr string, entities ...Entity) (Entity, uuid.UUID, error) {
+	allowed := r.expandUnions(entities)
+	parsedEntity, payload, err := r.decodePayload(uuidStr)
+	if err != nil {
+		return NullEntity, uuid.Nil, err
+	}
+	if err := r.checkPlainEntity(parsedEntity); err != nil {
+		return NullEntity, uuid.Nil, err
+	}
+	if !slices.Contains(allowed, parsedEntity) {
+		prefixes := make([]string, len(allowed))
+		for i, e := range allowed {
+			prefixes[i] = fmt.Sprintf("%q", r.prefixes[e])
+		}
+		return NullEntity, uuid.Nil, fmt.Errorf("%w: expected one of %s, got %q", ErrEntityMismatch, strings.Join(prefixes, ", "), r.prefixes[parsedEntity])
+	}
+
+	parsedUUID, err := uuid.FromBytes(payload)
+	if err != nil {
+		return NullEntity, uuid.Nil, errors.Join(err, ErrInvalidUUIDFormat)
+	}
+	return parsedEntity, parsedUUID, nil
+}
+
+// expandUnions replaces unions in entities with the entities they hold,
+// keeping the first occurrence of each entity.
+func (r *Registry) expandUnions(entities []Entity) []Entity {
+	expanded := make([]Entity, 0, len(entities))
+	for _, e := range entities {
+		members, ok := r.unions[e]
+		if !ok {
+			members = []Entity{e}
+		}
+		for _, m := range members {
+			if !slices.Contains(expanded, m) {
+				expanded = append(expanded, m)
+			}
+		}
+	}
+	return expanded
+}
@@ -0,0 +1,50 @@
+package prefixed_uuids
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+const AnyUser Entity = 40
+
+func TestDeserializeOneOf(t *testing.T) {
+	r := mustRegistry(t,
+		[]PrefixInfo{{User, "user"}, {UserV2, "user_v2"}, {UserV3, "user_v3"}, {Post, "post"}},
+		[]MultiPrefixInfo{{UserPost, "up", []Entity{User, Post}}},
+	)
+	r, err := r.WithUnions(UnionInfo{AnyUser, []Entity{User, UserV2, UserV3}})
+	assert.NoError(t, err)
+	u := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+
+	for _, entity := range []Entity{User, UserV2, UserV3} {
+		id := r.Serialize(entity, u)
+
+		parsedEntity, parsed, err := r.DeserializeOneOf(id, User, UserV2, UserV3)
+		assert.NoError(t, err)
+		assert.Equal(t, entity, parsedEntity)
+		assert.Equal(t, u, parsed)
+
+		parsedEntity, parsed, err = r.DeserializeOneOf(id, AnyUser)
+		assert.NoError(t, err)
+		assert.Equal(t, entity, parsedEntity)
+		assert.Equal(t, u, parsed)
+	}
+
+	_, _, err = r.DeserializeOneOf(r.Serialize(Post, u), AnyUser)
+	assert.ErrorIs(t, err, ErrEntityMismatch)
+	assert.ErrorContains(t, err, `expected one of "user", "user_v2", "user_v3", got "post"`)
+
+	_, _, err = r.DeserializeOneOf(r.Serialize(UserV3, u), User, UserV2)
+	assert.ErrorContains(t, err, `expected one of "user", "user_v2", got "user_v3"`)
+
+	// Multi IDs hold more than one UUID.
+	up, err := r.SerializeMulti(UserPost, EntityUUID{User, u}, EntityUUID{Post, u})
+	assert.NoError(t, err)
+	_, _, err = r.DeserializeOneOf(up, UserPost, User)
+	assert.ErrorIs(t, err, ErrInvalidUUIDFormat)
+
+	_, _, err = r.DeserializeOneOf("unknown.AZXje_k_dRiprKK-aEY8fg", AnyUser)
+	assert.ErrorIs(t, err, ErrUnknownPrefix)
+}
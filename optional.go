@@ -0,0 +1,246 @@
+package prefixed_uuids
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// optionalFlag marks a multi type component as optional. It is kept out of
+// the range of entity values used in practice.
+const optionalFlag Entity = 1 << 30
+
+// Optional marks a component of a multi type as optional, e.g.
+//
+//	MultiPrefixInfo{UserPostComment, "upc", []Entity{User, Post, Optional(Comment)}}
+//
+// The presence of optional components is stored in a bitmap at the start of
+// the payload, so SerializeMulti accepts the pairs with or without them.
+func Optional(entity Entity) Entity {
+	return entity | optionalFlag
+}
+
+// splitOptional returns the entity of a multi type component and whether it
+// is optional.
+func splitOptional(component Entity) (Entity, bool) {
+	return component &^ optionalFlag, component&optionalFlag != 0
+}
+
+// optionalCount returns the number of optional components.
+func optionalCount(components []Entity) int {
+	n := 0
+	for _, c := range components {
+		if _, optional := splitOptional(c); optional {
+			n++
+		}
+	}
+	return n
+}
+
+// checkOptionalComponents rejects multi types where SerializeMulti could
+// not tell which component a pair belongs to: pairs are matched to
+// components in order, so an optional component must not accept an entity
+// of a later required component it could take the place of.
+func (r *Registry) checkOptionalComponents(components []Entity) error {
+	for i, c := range components {
+		entity, optional := splitOptional(c)
+		if !optional {
+			continue
+		}
+		for _, next := range components[i+1:] {
+			if _, nextOptional := splitOptional(next); nextOptional {
+				continue
+			}
+			for _, e := range r.members(next) {
+				if r.accepts(entity, e) {
+					return fmt.Errorf("optional component entity %d is ambiguous with the required component after it", entity)
+				}
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// bitmapLen returns the length in bytes of the presence bitmap of a multi
+// type with n optional components.
+func bitmapLen(n int) int {
+	return (n + 7) / 8
+}
+
+// formatComponents formats multi type components, marking optional ones
+// with a trailing "?".
+func formatComponents(components []Entity) string {
+	parts := make([]string, len(components))
+	for i, c := range components {
+		entity, optional := splitOptional(c)
+		parts[i] = strconv.Itoa(int(entity))
+		if optional {
+			parts[i] += "?"
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// multiPrefixInfoJSON is the JSON form of MultiPrefixInfo.
+type multiPrefixInfoJSON struct {
+	Entity   Entity            `json:"entity"`
+	Prefix   string            `json:"prefix"`
+	Entities []json.RawMessage `json:"entities"`
+}
+
+// MarshalJSON encodes optional components as strings with a trailing "?",
+// e.g. [1, 2, "3?"], like Canonical does, so definition files don't depend
+// on the bit Optional sets.
+func (m MultiPrefixInfo) MarshalJSON() ([]byte, error) {
+	entities := make([]json.RawMessage, len(m.Entities))
+	for i, c := range m.Entities {
+		entity, optional := splitOptional(c)
+		if optional {
+			entities[i] = json.RawMessage(strconv.Quote(strconv.Itoa(int(entity)) + "?"))
+		} else {
+			entities[i] = json.RawMessage(strconv.Itoa(int(entity)))
+		}
+	}
+	return json.Marshal(multiPrefixInfoJSON{m.Entity, m.Prefix, entities})
+}
+
+// UnmarshalJSON decodes the form written by MarshalJSON.
+func (m *MultiPrefixInfo) UnmarshalJSON(data []byte) error {
+	var raw multiPrefixInfoJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	entities := make([]Entity, len(raw.Entities))
+	for i, e := range raw.Entities {
+		var number Entity
+		if err := json.Unmarshal(e, &number); err == nil {
+			if number&optionalFlag != 0 {
+				return fmt.Errorf("multi type %d: component %d is out of range, mark optional components as \"<entity>?\"", raw.Entity, number)
+			}
+			entities[i] = number
+			continue
+		}
+		var text string
+		if err := json.Unmarshal(e, &text); err != nil {
+			return fmt.Errorf("multi type %d: component %s must be an entity or \"<entity>?\"", raw.Entity, e)
+		}
+		number, err := parseOptionalComponent(text)
+		if err != nil {
+			return fmt.Errorf("multi type %d: %w", raw.Entity, err)
+		}
+		entities[i] = number
+	}
+	*m = MultiPrefixInfo{raw.Entity, raw.Prefix, entities}
+	return nil
+}
+
+// parseOptionalComponent parses an optional component such as "3?".
+func parseOptionalComponent(text string) (Entity, error) {
+	digits, ok := strings.CutSuffix(text, "?")
+	n, err := strconv.Atoi(digits)
+	if !ok || err != nil || n <= 0 || Entity(n)&optionalFlag != 0 {
+		return NullEntity, fmt.Errorf("invalid optional component %q, expected \"<entity>?\"", text)
+	}
+	return Optional(Entity(n)), nil
+}
+
+// multiPayloadLengths returns the possible payload lengths in bytes of a
+// multi type with the given components.
+func (r *Registry) multiPayloadLengths(components []Entity) []int {
+	lengths := map[int]bool{bitmapLen(optionalCount(components)): true}
+	for _, c := range components {
+		size := r.componentSize(c)
+		_, optional := splitOptional(c)
+		next := make(map[int]bool, 2*len(lengths))
+		for l := range lengths {
+			next[l+size] = true
+			if optional {
+				next[l] = true
+			}
+		}
+		lengths = next
+	}
+	sorted := make([]int, 0, len(lengths))
+	for l := range lengths {
+		sorted = append(sorted, l)
+	}
+	sort.Ints(sorted)
+	return sorted
+}
+
+// readBitmap reads the presence bitmap from the start of the payload of a
+// multi type and reports which components are present.
+func readBitmap(components []Entity, payload []byte) ([]bool, []byte, error) {
+	present := make([]bool, len(components))
+	optional := optionalCount(components)
+	n := bitmapLen(optional)
+	if len(payload) < n {
+		return nil, nil, fmt.Errorf("%w", ErrInvalidUUIDFormat)
+	}
+	bitmap := payload[:n]
+	for i, b := range bitmap {
+		// Bits past the last optional component must not be set.
+		if unused := 8*(i+1) - optional; unused > 0 && b>>(8-unused) != 0 {
+			return nil, nil, fmt.Errorf("%w: invalid presence bitmap", ErrInvalidUUIDFormat)
+		}
+	}
+	bit := 0
+	for i, c := range components {
+		if _, isOptional := splitOptional(c); !isOptional {
+			present[i] = true
+			continue
+		}
+		present[i] = bitmap[bit/8]&(1<<(bit%8)) != 0
+		bit++
+	}
+	return present, payload[n:], nil
+}
+
+// serializeOptionalMulti serializes a multi type with optional components.
+// Pairs are matched to components in order and optional components without
+// a pair are skipped.
+func (r *Registry) serializeOptionalMulti(entity Entity, components []Entity, pairs []EntityUUID) (string, error) {
+	bitmap := make([]byte, bitmapLen(optionalCount(components)))
+	buf := make([]byte, 0, len(bitmap)+len(pairs)*16)
+	buf = append(buf, bitmap...)
+
+	next, bit := 0, 0
+	for i, c := range components {
+		component, optional := splitOptional(c)
+		present := false
+		if next < len(pairs) {
+			buf, present = r.appendComponent(buf, c, pairs[next])
+		}
+		switch {
+		case present:
+			next++
+			if optional {
+				buf[bit/8] |= 1 << (bit % 8)
+			}
+		case !optional && next < len(pairs):
+			return "", fmt.Errorf("%w: position %d expected entity %d, got %d", ErrEntityOrderMismatch, i, component, pairs[next].Entity)
+		case !optional:
+			return "", fmt.Errorf("%w: missing required entity %d at position %d", ErrUUIDCountMismatch, component, i)
+		}
+		if optional {
+			bit++
+		}
+	}
+	if next < len(pairs) {
+		return "", fmt.Errorf("%w: expected at most %d, got %d", ErrUUIDCountMismatch, len(components), len(pairs))
+	}
+	buf = r.compress(entity, components, buf)
+
+	return fmt.Sprintf("%s%s%s", r.prefixes[entity], r.separator, r.encode(buf)), nil
+}
+
+// DeserializeMultiOptional deserializes a multi type like DeserializeMulti
+// and also reports which targets were present in the ID. Targets of absent
+// optional components are left untouched. For multi types without optional
+// components every target is present.
+func (r *Registry) DeserializeMultiOptional(entity Entity, uuidStr string, targets ...EntityUUIDPtr) ([]bool, error) {
+	return r.deserializeMulti(entity, uuidStr, targets)
+}
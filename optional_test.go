@@ -0,0 +1,193 @@
+package prefixed_uuids
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+const UserPostMaybeComment Entity = 22
+
+func newOptionalRegistry(t *testing.T) *Registry {
+	t.Helper()
+	return mustRegistry(t,
+		[]PrefixInfo{{User, "user"}, {Post, "post"}, {Comment, "comment"}},
+		[]MultiPrefixInfo{
+			{UserPost, "up", []Entity{User, Post}},
+			{UserPostMaybeComment, "upc", []Entity{User, Post, Optional(Comment)}},
+		},
+	)
+}
+
+func TestOptionalRoundTrip(t *testing.T) {
+	r := newOptionalRegistry(t)
+	userID := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+	postID := uuid.MustParse("0195e37c-1a2b-7c3d-8e4f-5a6b7c8d9e0f")
+	commentID := uuid.MustParse("0195e37d-2b3c-7d4e-9f5a-6b7c8d9e0f1a")
+
+	withComment, err := r.SerializeMulti(UserPostMaybeComment,
+		EntityUUID{User, userID},
+		EntityUUID{Post, postID},
+		EntityUUID{Comment, commentID},
+	)
+	assert.NoError(t, err)
+	withoutComment, err := r.SerializeMulti(UserPostMaybeComment,
+		EntityUUID{User, userID},
+		EntityUUID{Post, postID},
+	)
+	assert.NoError(t, err)
+	// One bitmap byte followed by the present UUIDs.
+	assert.Len(t, withComment, len("upc.")+base64withNoPadding.EncodedLen(1+48))
+	assert.Len(t, withoutComment, len("upc.")+base64withNoPadding.EncodedLen(1+32))
+
+	var user, post, comment uuid.UUID
+	present, err := r.DeserializeMultiOptional(UserPostMaybeComment, withComment,
+		EntityUUIDPtr{User, &user},
+		EntityUUIDPtr{Post, &post},
+		EntityUUIDPtr{Comment, &comment},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{true, true, true}, present)
+	assert.Equal(t, []uuid.UUID{userID, postID, commentID}, []uuid.UUID{user, post, comment})
+
+	// Absent components leave their targets untouched.
+	user, post, comment = uuid.Nil, uuid.Nil, uuid.Max
+	present, err = r.DeserializeMultiOptional(UserPostMaybeComment, withoutComment,
+		EntityUUIDPtr{User, &user},
+		EntityUUIDPtr{Post, &post},
+		EntityUUIDPtr{Comment, &comment},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{true, true, false}, present)
+	assert.Equal(t, []uuid.UUID{userID, postID, uuid.Max}, []uuid.UUID{user, post, comment})
+
+	comment = uuid.Nil
+	err = r.DeserializeMulti(UserPostMaybeComment, withoutComment,
+		EntityUUIDPtr{User, &user},
+		EntityUUIDPtr{Post, &post},
+		EntityUUIDPtr{Comment, &comment},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, uuid.Nil, comment)
+
+	// Multi types without optional components report every target present.
+	up, err := r.SerializeMulti(UserPost, EntityUUID{User, userID}, EntityUUID{Post, postID})
+	assert.NoError(t, err)
+	present, err = r.DeserializeMultiOptional(UserPost, up, EntityUUIDPtr{User, &user}, EntityUUIDPtr{Post, &post})
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{true, true}, present)
+}
+
+func TestOptionalErrors(t *testing.T) {
+	r := newOptionalRegistry(t)
+	u := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+
+	_, err := r.SerializeMulti(UserPostMaybeComment, EntityUUID{User, u})
+	assert.ErrorIs(t, err, ErrUUIDCountMismatch)
+	_, err = r.SerializeMulti(UserPostMaybeComment, EntityUUID{User, u}, EntityUUID{Comment, u})
+	assert.ErrorIs(t, err, ErrEntityOrderMismatch)
+	_, err = r.SerializeMulti(UserPostMaybeComment,
+		EntityUUID{User, u}, EntityUUID{Post, u}, EntityUUID{Comment, u}, EntityUUID{Comment, u})
+	assert.ErrorIs(t, err, ErrUUIDCountMismatch)
+
+	encoded, err := r.SerializeMulti(UserPostMaybeComment, EntityUUID{User, u}, EntityUUID{Post, u})
+	assert.NoError(t, err)
+	var user, post uuid.UUID
+	err = r.DeserializeMulti(UserPostMaybeComment, encoded, EntityUUIDPtr{User, &user}, EntityUUIDPtr{Post, &post})
+	assert.ErrorIs(t, err, ErrUUIDCountMismatch)
+
+	tests := []struct {
+		name    string
+		payload []byte
+	}{
+		{"empty", nil},
+		{"bitmap only", []byte{0}},
+		{"unused bitmap bit", append([]byte{2}, make([]byte, 32)...)},
+		{"bitmap does not match length", append([]byte{1}, make([]byte, 32)...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var user, post, comment uuid.UUID
+			_, err := r.DeserializeMultiOptional(UserPostMaybeComment, "upc."+base64withNoPadding.EncodeToString(tt.payload),
+				EntityUUIDPtr{User, &user},
+				EntityUUIDPtr{Post, &post},
+				EntityUUIDPtr{Comment, &comment},
+			)
+			assert.ErrorIs(t, err, ErrInvalidUUIDFormat)
+		})
+	}
+}
+
+func TestOptionalValidation(t *testing.T) {
+	prefixes := []PrefixInfo{{User, "user"}, {Post, "post"}}
+
+	_, err := NewRegistry2(prefixes, []MultiPrefixInfo{{UserPost, "up", []Entity{User, Optional(Comment)}}})
+	assert.ErrorContains(t, err, "component entity 3 is not registered")
+
+	_, err = NewRegistry2(prefixes, []MultiPrefixInfo{{UserPost, "up", []Entity{Optional(Post), Optional(User), Post}}})
+	assert.ErrorContains(t, err, "ambiguous")
+
+	_, err = NewRegistry2(prefixes, []MultiPrefixInfo{{UserPost, "up", []Entity{Optional(Post), User, Post}}})
+	assert.NoError(t, err)
+
+	// Entities with the bit Optional sets would be read as optional
+	// components.
+	_, err = NewRegistry2([]PrefixInfo{{User, "user"}, {Optional(Post), "big"}}, nil)
+	assert.ErrorContains(t, err, "entity 1073741826 is out of range")
+	_, err = NewRegistry2(prefixes, []MultiPrefixInfo{{Optional(UserPost), "up", []Entity{User, Post}}})
+	assert.ErrorContains(t, err, "out of range")
+	_, err = mustRegistry(t, prefixes, nil).WithUnions(UnionInfo{Optional(Commentable), []Entity{User, Post}})
+	assert.ErrorContains(t, err, "out of range")
+}
+
+func TestOptionalWithPayloadCharSeparator(t *testing.T) {
+	r := newOptionalRegistry(t)
+	r, err := r.WithSeparator("-")
+	assert.NoError(t, err)
+	u := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+
+	for _, pairs := range [][]EntityUUID{
+		{{User, u}, {Post, u}},
+		{{User, u}, {Post, u}, {Comment, u}},
+	} {
+		encoded, err := r.SerializeMulti(UserPostMaybeComment, pairs...)
+		assert.NoError(t, err)
+		entity, _, err := r.decodePayload(encoded)
+		assert.NoError(t, err)
+		assert.Equal(t, UserPostMaybeComment, entity)
+	}
+}
+
+func TestOptionalDefinition(t *testing.T) {
+	def := newOptionalRegistry(t).Definition()
+	assert.Contains(t, string(def.Canonical()), "multi 22 upc 1 2 3?\n")
+
+	required := def
+	required.Multi = []MultiPrefixInfo{{UserPost, "up", []Entity{User, Post}}, {UserPostMaybeComment, "upc", []Entity{User, Post, Comment}}}
+	assert.Equal(t, []string{
+		`breaking: multi type 22 ("upc") components changed from [1 2 3?] to [1 2 3]`,
+	}, changeMessages(CheckCompatibility(def, required)))
+}
+
+func TestOptionalDefinitionJSON(t *testing.T) {
+	def := newOptionalRegistry(t).Definition()
+	encoded, err := json.Marshal(def.Multi)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"entity": 10, "prefix": "up", "entities": [1, 2]},
+		{"entity": 22, "prefix": "upc", "entities": [1, 2, "3?"]}
+	]`, string(encoded))
+
+	var decoded []MultiPrefixInfo
+	assert.NoError(t, json.Unmarshal(encoded, &decoded))
+	assert.Equal(t, def.Multi, decoded)
+
+	// Hand-written definitions can't use the raw bit.
+	for _, entities := range []string{`[1, 1073741827]`, `[1, "3"]`, `[1, "x?"]`, `[1, "0?"]`, `[1, true]`} {
+		_, err = ReadDefinition(strings.NewReader(`{"multi": [{"entity": 22, "prefix": "upc", "entities": ` + entities + `}]}`))
+		assert.Error(t, err, entities)
+	}
+}
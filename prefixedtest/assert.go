@@ -0,0 +1,71 @@
+package prefixedtest
+
+import (
+	"github.com/google/uuid"
+	prefixed_uuids "github.com/minhajuddin/prefixed_uuids"
+)
+
+// T is the subset of testing.TB used by the assertion helpers.
+type T interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// AssertEntity asserts that id is a valid prefixed ID of entity and returns
+// its UUID, or uuid.Nil if the assertion failed.
+func AssertEntity(t T, codec prefixed_uuids.Codec, id string, entity prefixed_uuids.Entity) uuid.UUID {
+	t.Helper()
+	parsed, _ := assertEntity(t, codec, id, entity)
+	return parsed
+}
+
+func assertEntity(t T, codec prefixed_uuids.Codec, id string, entity prefixed_uuids.Entity) (uuid.UUID, bool) {
+	t.Helper()
+	parsedEntity, parsed, err := codec.DeserializeWithEntity(id)
+	if err != nil {
+		t.Errorf("%q is not a valid prefixed id: %v", id, err)
+		return uuid.Nil, false
+	}
+	if parsedEntity != entity {
+		t.Errorf("%q has entity %d, expected %d", id, parsedEntity, entity)
+		return uuid.Nil, false
+	}
+	return parsed, true
+}
+
+// AssertID asserts that id is the prefixed ID of expected for entity.
+func AssertID(t T, codec prefixed_uuids.Codec, id string, entity prefixed_uuids.Entity, expected uuid.UUID) bool {
+	t.Helper()
+	parsed, ok := assertEntity(t, codec, id, entity)
+	if !ok {
+		return false
+	}
+	if parsed != expected {
+		t.Errorf("%q has uuid %s, expected %s", id, parsed, expected)
+		return false
+	}
+	return true
+}
+
+// AssertMulti asserts that id is a multi ID of entity holding the expected
+// components, in order.
+func AssertMulti(t T, codec prefixed_uuids.Codec, id string, entity prefixed_uuids.Entity, expected ...prefixed_uuids.EntityUUID) bool {
+	t.Helper()
+	parsed := make([]uuid.UUID, len(expected))
+	targets := make([]prefixed_uuids.EntityUUIDPtr, len(expected))
+	for i, e := range expected {
+		targets[i] = prefixed_uuids.EntityUUIDPtr{Entity: e.Entity, UUID: &parsed[i]}
+	}
+	if err := codec.DeserializeMulti(entity, id, targets...); err != nil {
+		t.Errorf("%q is not a valid multi id of entity %d: %v", id, entity, err)
+		return false
+	}
+	ok := true
+	for i, e := range expected {
+		if parsed[i] != e.UUID {
+			t.Errorf("%q component %d has uuid %s, expected %s", id, i, parsed[i], e.UUID)
+			ok = false
+		}
+	}
+	return ok
+}
@@ -0,0 +1,122 @@
+package prefixedtest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	prefixed_uuids "github.com/minhajuddin/prefixed_uuids"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	User     prefixed_uuids.Entity = 1
+	Post     prefixed_uuids.Entity = 2
+	UserPost prefixed_uuids.Entity = 10
+)
+
+func newRegistry(t *testing.T) *prefixed_uuids.Registry {
+	t.Helper()
+	r, err := prefixed_uuids.NewRegistry2(
+		[]prefixed_uuids.PrefixInfo{{Entity: User, Prefix: "user"}, {Entity: Post, Prefix: "post"}},
+		[]prefixed_uuids.MultiPrefixInfo{{Entity: UserPost, Prefix: "up", Entities: []prefixed_uuids.Entity{User, Post}}},
+	)
+	assert.NoError(t, err)
+	return r
+}
+
+// fakeT records assertion failures instead of failing the test.
+type fakeT struct {
+	errors []string
+}
+
+func (f *fakeT) Helper() {}
+
+func (f *fakeT) Errorf(format string, args ...any) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func TestFactory(t *testing.T) {
+	r := newRegistry(t)
+	a, b := NewFactory(r, 42), NewFactory(r, 42)
+
+	u1 := a.UUID(User)
+	u2 := a.UUID(User)
+	assert.NotEqual(t, u1, u2)
+	assert.Equal(t, uuid.Version(4), u1.Version())
+	assert.Equal(t, uuid.RFC4122, u1.Variant())
+
+	// Generating other entities does not shift the sequence.
+	b.UUID(Post)
+	assert.Equal(t, u1, b.UUID(User))
+	assert.Equal(t, u2, b.UUID(User))
+
+	a.Reset()
+	assert.Equal(t, r.Serialize(User, u1), a.ID(User))
+	assert.Equal(t, prefixed_uuids.EntityUUID{Entity: User, UUID: u2}, a.EntityUUID(User))
+
+	assert.NotEqual(t, u1, NewFactory(r, 43).UUID(User))
+	assert.NotEqual(t, u1, NewFactory(r, 42).UUID(Post))
+}
+
+func TestAssertions(t *testing.T) {
+	r := newRegistry(t)
+	f := NewFactory(r, 1)
+	u := f.UUID(User)
+	id := r.Serialize(User, u)
+
+	assert.Equal(t, u, AssertEntity(t, r, id, User))
+	assert.True(t, AssertID(t, r, id, User, u))
+
+	pair := []prefixed_uuids.EntityUUID{f.EntityUUID(User), f.EntityUUID(Post)}
+	multi, err := r.SerializeMulti(UserPost, pair...)
+	assert.NoError(t, err)
+	assert.True(t, AssertMulti(t, r, multi, UserPost, pair...))
+
+	ft := &fakeT{}
+	assert.Equal(t, uuid.Nil, AssertEntity(ft, r, id, Post))
+	assert.False(t, AssertID(ft, r, id, User, f.UUID(User)))
+	assert.False(t, AssertID(ft, r, "nope", User, u))
+	assert.False(t, AssertMulti(ft, r, multi, UserPost, pair[0], f.EntityUUID(Post)))
+	assert.False(t, AssertMulti(ft, r, id, UserPost, pair...))
+	assert.Len(t, ft.errors, 5)
+	assert.Contains(t, ft.errors[0], "has entity 1, expected 2")
+	assert.Contains(t, ft.errors[2], "is not a valid prefixed id")
+}
+
+func TestRecorder(t *testing.T) {
+	r := newRegistry(t)
+	f := NewFactory(r, 1)
+	rec := NewRecorder(r)
+	u := f.UUID(User)
+
+	id := rec.Serialize(User, u)
+	parsed, err := rec.Deserialize(User, id)
+	assert.NoError(t, err)
+	assert.Equal(t, u, parsed)
+	_, _, err = rec.DeserializeWithEntity("bogus")
+	assert.Error(t, err)
+
+	pair := []prefixed_uuids.EntityUUID{f.EntityUUID(User), f.EntityUUID(Post)}
+	multi, err := rec.SerializeMulti(UserPost, pair...)
+	assert.NoError(t, err)
+	var pu, pp uuid.UUID
+	err = rec.DeserializeMulti(UserPost, multi,
+		prefixed_uuids.EntityUUIDPtr{Entity: User, UUID: &pu},
+		prefixed_uuids.EntityUUIDPtr{Entity: Post, UUID: &pp},
+	)
+	assert.NoError(t, err)
+
+	calls := rec.Calls()
+	assert.Len(t, calls, 5)
+	assert.Equal(t, Call{Method: "Serialize", Entity: User, UUIDs: []uuid.UUID{u}, ID: id}, calls[0])
+	assert.Equal(t, Call{Method: "Deserialize", Entity: User, UUIDs: []uuid.UUID{u}, ID: id}, calls[1])
+	assert.Equal(t, "DeserializeWithEntity", calls[2].Method)
+	assert.Error(t, calls[2].Err)
+	assert.Equal(t, []uuid.UUID{pair[0].UUID, pair[1].UUID}, calls[3].UUIDs)
+	assert.Equal(t, []uuid.UUID{pu, pp}, calls[4].UUIDs)
+
+	assert.Len(t, rec.CallsTo("Serialize"), 1)
+	rec.Reset()
+	assert.Empty(t, rec.Calls())
+}
@@ -0,0 +1,109 @@
+package prefixedtest
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+	prefixed_uuids "github.com/minhajuddin/prefixed_uuids"
+)
+
+// Call is a single call recorded by a Recorder.
+type Call struct {
+	Method string
+	Entity prefixed_uuids.Entity
+	// UUIDs holds the UUIDs passed to Serialize and SerializeMulti, or
+	// returned by the deserialize methods.
+	UUIDs []uuid.UUID
+	// ID holds the prefixed ID returned by the serialize methods, or
+	// passed to the deserialize methods.
+	ID  string
+	Err error
+}
+
+// Recorder is a prefixed_uuids.Codec which delegates to another Codec and
+// records every call, so tests can assert on how the code under test
+// serializes and deserializes IDs.
+type Recorder struct {
+	codec prefixed_uuids.Codec
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+var _ prefixed_uuids.Codec = (*Recorder)(nil)
+
+// NewRecorder returns a Recorder delegating to codec.
+func NewRecorder(codec prefixed_uuids.Codec) *Recorder {
+	return &Recorder{codec: codec}
+}
+
+func (r *Recorder) record(call Call) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, call)
+}
+
+// Calls returns the calls recorded so far.
+func (r *Recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call(nil), r.calls...)
+}
+
+// CallsTo returns the calls recorded so far to the given method.
+func (r *Recorder) CallsTo(method string) []Call {
+	var calls []Call
+	for _, c := range r.Calls() {
+		if c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// Reset clears the recorded calls.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = nil
+}
+
+func (r *Recorder) Serialize(entity prefixed_uuids.Entity, u uuid.UUID) string {
+	id := r.codec.Serialize(entity, u)
+	r.record(Call{Method: "Serialize", Entity: entity, UUIDs: []uuid.UUID{u}, ID: id})
+	return id
+}
+
+func (r *Recorder) Deserialize(entity prefixed_uuids.Entity, uuidStr string) (uuid.UUID, error) {
+	u, err := r.codec.Deserialize(entity, uuidStr)
+	r.record(Call{Method: "Deserialize", Entity: entity, UUIDs: []uuid.UUID{u}, ID: uuidStr, Err: err})
+	return u, err
+}
+
+func (r *Recorder) DeserializeWithEntity(uuidStr string) (prefixed_uuids.Entity, uuid.UUID, error) {
+	entity, u, err := r.codec.DeserializeWithEntity(uuidStr)
+	r.record(Call{Method: "DeserializeWithEntity", Entity: entity, UUIDs: []uuid.UUID{u}, ID: uuidStr, Err: err})
+	return entity, u, err
+}
+
+func (r *Recorder) SerializeMulti(entity prefixed_uuids.Entity, pairs ...prefixed_uuids.EntityUUID) (string, error) {
+	id, err := r.codec.SerializeMulti(entity, pairs...)
+	uuids := make([]uuid.UUID, len(pairs))
+	for i, p := range pairs {
+		uuids[i] = p.UUID
+	}
+	r.record(Call{Method: "SerializeMulti", Entity: entity, UUIDs: uuids, ID: id, Err: err})
+	return id, err
+}
+
+func (r *Recorder) DeserializeMulti(entity prefixed_uuids.Entity, uuidStr string, targets ...prefixed_uuids.EntityUUIDPtr) error {
+	err := r.codec.DeserializeMulti(entity, uuidStr, targets...)
+	uuids := make([]uuid.UUID, len(targets))
+	for i, t := range targets {
+		if t.UUID != nil {
+			uuids[i] = *t.UUID
+		}
+	}
+	r.record(Call{Method: "DeserializeMulti", Entity: entity, UUIDs: uuids, ID: uuidStr, Err: err})
+	return err
+}
@@ -0,0 +1,159 @@
+package prefixed_uuids
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// rawUUIDPattern matches a UUID in its canonical hyphenated form.
+const rawUUIDPattern = `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`
+
+// RewriteRule maps a log field to the entity of the raw UUIDs it holds,
+// e.g. {"user_id", User}.
+type RewriteRule struct {
+	Field  string `json:"field"`
+	Entity Entity `json:"entity"`
+}
+
+// Rewriter converts raw UUIDs in log lines to prefixed IDs and back, so
+// logs of legacy services tell a user ID from a session ID. Raw UUIDs are
+// rewritten when they are the value of a field with a rule, either in
+// text form (user_id=<uuid>, user_id: <uuid> or user_id="<uuid>") or as a
+// JSON string ("user_id": "<uuid>"). Other UUIDs are left alone.
+type Rewriter struct {
+	registry *Registry
+	fields   map[string]Entity
+	re       *regexp.Regexp
+}
+
+// NewRewriter returns a Rewriter applying rules. Rule entities must be
+// plain entities, and fields must be unique. A Rewriter without rules can
+// only Reverse.
+func NewRewriter(r *Registry, rules ...RewriteRule) (*Rewriter, error) {
+	fields := make(map[string]Entity, len(rules))
+	names := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		if rule.Field == "" {
+			return nil, fmt.Errorf("rewrite rule field cannot be empty")
+		}
+		if _, ok := fields[rule.Field]; ok {
+			return nil, fmt.Errorf("field %q has more than one rewrite rule", rule.Field)
+		}
+		if _, ok := r.prefixes[rule.Entity]; !ok || r.isComposite(rule.Entity) || r.secrets[rule.Entity] || r.tenantScoped[rule.Entity] {
+			return nil, fmt.Errorf("entity %d of field %q is not a plain entity registered in the registry", rule.Entity, rule.Field)
+		}
+		fields[rule.Field] = rule.Entity
+		names = append(names, regexp.QuoteMeta(rule.Field))
+	}
+	w := &Rewriter{registry: r, fields: fields}
+	if len(names) > 0 {
+		sortLongestFirst(names)
+		field := "(" + strings.Join(names, "|") + ")"
+		w.re = regexp.MustCompile(`(?:"` + field + `"\s*:\s*"|\b` + field + `\s*[=:]\s*"?)(` + rawUUIDPattern + `)`)
+	}
+	return w, nil
+}
+
+// Rewrite replaces the raw UUIDs of the fields with rules in line with
+// their prefixed IDs.
+func (w *Rewriter) Rewrite(line string) string {
+	if w.re == nil {
+		return line
+	}
+	var b strings.Builder
+	last := 0
+	for _, loc := range w.re.FindAllStringSubmatchIndex(line, -1) {
+		start, end := loc[6], loc[7]
+		if !isIDBoundary(line, end) {
+			continue
+		}
+		// The field is captured by the JSON or the text alternative.
+		var field string
+		if loc[2] >= 0 {
+			field = line[loc[2]:loc[3]]
+		} else {
+			field = line[loc[4]:loc[5]]
+		}
+		u, err := uuid.Parse(line[start:end])
+		if err != nil {
+			continue
+		}
+		b.WriteString(line[last:start])
+		b.WriteString(w.registry.Serialize(w.fields[field], u))
+		last = end
+	}
+	if last == 0 {
+		return line
+	}
+	b.WriteString(line[last:])
+	return b.String()
+}
+
+// Reverse replaces every valid prefixed ID in line, whether or not its
+// field has a rule, with its raw UUID, so logs can be grepped for UUIDs
+// found elsewhere. Multi and list IDs are replaced with their UUIDs
+// separated by commas.
+func (w *Rewriter) Reverse(line string) string {
+	matches := w.registry.FindAll(line)
+	if len(matches) == 0 {
+		return line
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(line[last:m.Offset])
+		for i, pair := range m.UUIDs {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(pair.UUID.String())
+		}
+		last = int(m.Offset) + len(m.ID)
+	}
+	b.WriteString(line[last:])
+	return b.String()
+}
+
+// RewriteStream copies src to dst a line at a time, applying Rewrite.
+func (w *Rewriter) RewriteStream(dst io.Writer, src io.Reader) error {
+	return filterLines(dst, src, w.Rewrite)
+}
+
+// ReverseStream copies src to dst a line at a time, applying Reverse.
+func (w *Rewriter) ReverseStream(dst io.Writer, src io.Reader) error {
+	return filterLines(dst, src, w.Reverse)
+}
+
+// filterLines copies src to dst a line at a time, applying filter. Output
+// is flushed whenever no more input is buffered, so lines of a followed log
+// aren't held back.
+func filterLines(dst io.Writer, src io.Reader, filter func(string) string) error {
+	br := bufio.NewReader(src)
+	bw := bufio.NewWriter(dst)
+	for {
+		line, err := br.ReadString('\n')
+		if len(line) > 0 {
+			if _, werr := bw.WriteString(filter(line)); werr != nil {
+				return werr
+			}
+		}
+		if br.Buffered() == 0 {
+			if werr := bw.Flush(); werr != nil {
+				return werr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return bw.Flush()
+		}
+		if err != nil {
+			bw.Flush()
+			return err
+		}
+	}
+}
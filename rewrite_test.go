@@ -0,0 +1,113 @@
+package prefixed_uuids
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRewriter(t *testing.T) *Rewriter {
+	t.Helper()
+	w, err := NewRewriter(prefixer,
+		RewriteRule{"user_id", User},
+		RewriteRule{"post_id", Post},
+		RewriteRule{"sid", SessionID},
+	)
+	assert.NoError(t, err)
+	return w
+}
+
+func TestRewrite(t *testing.T) {
+	w := newTestRewriter(t)
+	u := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+	user := prefixer.Serialize(User, u)
+	post := prefixer.Serialize(Post, u)
+	session := prefixer.Serialize(SessionID, u)
+
+	tests := []struct {
+		name     string
+		line     string
+		expected string
+	}{
+		{"logfmt", "level=info user_id=" + u.String() + " msg=ok\n", "level=info user_id=" + user + " msg=ok\n"},
+		{"quoted", `user_id="` + u.String() + `" post_id: ` + u.String(), `user_id="` + user + `" post_id: ` + post},
+		{"uppercase uuid", "sid=" + strings.ToUpper(u.String()), "sid=" + session},
+		{"json", `{"post_id": "` + u.String() + `","user_id":"` + u.String() + `"}`, `{"post_id": "` + post + `","user_id":"` + user + `"}`},
+		{"field without rule", "request_id=" + u.String(), "request_id=" + u.String()},
+		{"longer field", "other_user_id=" + u.String() + " old_sid=" + u.String(), "other_user_id=" + u.String() + " old_sid=" + u.String()},
+		{"not a uuid", "user_id=" + u.String() + "abc", "user_id=" + u.String() + "abc"},
+		{"already prefixed", "user_id=" + user, "user_id=" + user},
+		{"no fields", "nothing to see", "nothing to see"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, w.Rewrite(tt.line))
+		})
+	}
+}
+
+func TestReverse(t *testing.T) {
+	w := newTestRewriter(t)
+	u := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+	v := uuid.MustParse("0195e37c-1a2b-7c3d-8e4f-5a6b7c8d9e0f")
+	up, err := prefixer.SerializeMulti(UserPost, EntityUUID{User, u}, EntityUUID{Post, v})
+	assert.NoError(t, err)
+
+	line := `{"user_id":"` + prefixer.Serialize(User, u) + `","key":"` + up + `","note":"user.profile"}`
+	assert.Equal(t, `{"user_id":"`+u.String()+`","key":"`+u.String()+","+v.String()+`","note":"user.profile"}`, w.Reverse(line))
+
+	rewritten := w.Rewrite("user_id=" + u.String() + " post_id=" + v.String())
+	assert.Equal(t, "user_id="+u.String()+" post_id="+v.String(), w.Reverse(rewritten))
+
+	// Reversing doesn't need rules.
+	plain, err := NewRewriter(prefixer)
+	assert.NoError(t, err)
+	assert.Equal(t, "user_id="+u.String(), plain.Reverse("user_id="+prefixer.Serialize(User, u)))
+	assert.Equal(t, "user_id="+u.String(), plain.Rewrite("user_id="+u.String()))
+}
+
+func TestRewriteStream(t *testing.T) {
+	w := newTestRewriter(t)
+	u := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+	input := "a user_id=" + u.String() + "\n\nb post_id=" + u.String()
+
+	var out strings.Builder
+	assert.NoError(t, w.RewriteStream(&out, strings.NewReader(input)))
+	expected := "a user_id=" + prefixer.Serialize(User, u) + "\n\nb post_id=" + prefixer.Serialize(Post, u)
+	assert.Equal(t, expected, out.String())
+
+	var reversed strings.Builder
+	assert.NoError(t, w.ReverseStream(&reversed, strings.NewReader(out.String())))
+	assert.Equal(t, input, reversed.String())
+
+	readErr := errors.New("read failed")
+	out.Reset()
+	err := w.RewriteStream(&out, io.MultiReader(strings.NewReader("user_id="+u.String()+"\n"), iotest.ErrReader(readErr)))
+	assert.ErrorIs(t, err, readErr)
+	// Lines read before the error are still written.
+	assert.Equal(t, "user_id="+prefixer.Serialize(User, u)+"\n", out.String())
+}
+
+func TestNewRewriterValidation(t *testing.T) {
+	tests := []struct {
+		name          string
+		rules         []RewriteRule
+		expectedError string
+	}{
+		{"empty field", []RewriteRule{{"", User}}, "field cannot be empty"},
+		{"duplicate field", []RewriteRule{{"id", User}, {"id", Post}}, `field "id" has more than one rewrite rule`},
+		{"unregistered entity", []RewriteRule{{"id", 99}}, "entity 99 of field \"id\" is not a plain entity"},
+		{"multi type", []RewriteRule{{"id", UserPost}}, "entity 10 of field \"id\" is not a plain entity"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRewriter(prefixer, tt.rules...)
+			assert.ErrorContains(t, err, tt.expectedError)
+		})
+	}
+}
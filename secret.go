@@ -0,0 +1,202 @@
+package prefixed_uuids
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+)
+
+// secretLen is the number of random bytes in a secret token.
+const secretLen = 32
+
+// secretHashScheme names the hash used by Secret.Hash.
+const secretHashScheme = "sha256"
+
+// SecretChecksumCRC32 is the secret token checksum enabled by
+// Registry.WithSecretChecksums.
+const SecretChecksumCRC32 = "crc32"
+
+// secretChecksumLen is the number of checksum bytes appended to the random
+// bytes of secret tokens.
+const secretChecksumLen = 4
+
+// Secret is a secret token of a secret entity, e.g. an API key. Its String
+// and GoString methods redact the payload, so secrets can't leak into logs
+// through fmt. Use Reveal to get the token itself.
+type Secret struct {
+	entity    Entity
+	prefix    string
+	separator string
+	token     string
+}
+
+// WithSecrets makes the given entities secret. Their IDs are high entropy
+// tokens created with GenerateSecret instead of UUIDs, and only their
+// hashes should be stored. Deserialize, DeserializeOneOf and
+// DeserializeAny reject secret tokens, use ParseSecret and VerifySecret
+// instead. Serialize must not be used for secret entities, and they can't
+// be components of multi, list or union types.
+func (r *Registry) WithSecrets(entities ...Entity) (*Registry, error) {
+	if r.encoding == EncodingTypeID {
+		return nil, fmt.Errorf("secret entities are not supported by typeid registries")
+	}
+	for _, entity := range entities {
+		if _, ok := r.prefixes[entity]; !ok || r.isComposite(entity) {
+			return nil, fmt.Errorf("entity %d is not registered in the registry", entity)
+		}
+		if r.tenantScoped[entity] {
+			return nil, fmt.Errorf("entity %d is tenant scoped and cannot be secret", entity)
+		}
+		if r.isComponent(entity) {
+			return nil, fmt.Errorf("entity %d is a component of a multi, list or union type and cannot be secret", entity)
+		}
+	}
+
+	added := make([]Entity, 0, len(entities))
+	if r.secrets == nil {
+		r.secrets = make(map[Entity]bool)
+	}
+	for _, entity := range entities {
+		if !r.secrets[entity] {
+			r.secrets[entity] = true
+			added = append(added, entity)
+		}
+	}
+	if isPayloadChar(r.separator) {
+		if err := r.checkFixedLengthAmbiguity(r.separator); err != nil {
+			for _, entity := range added {
+				delete(r.secrets, entity)
+			}
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// GenerateSecret returns a new random token of the secret entity, with the
+// prefix of the registry's environment if entity is environment aware.
+func (r *Registry) GenerateSecret(entity Entity) (Secret, error) {
+	if !r.secrets[entity] {
+		return Secret{}, fmt.Errorf("%w: entity %d is not secret", ErrInvalidSecret, entity)
+	}
+	payload := make([]byte, secretLen)
+	if _, err := rand.Read(payload); err != nil {
+		return Secret{}, fmt.Errorf("generating secret: %w", err)
+	}
+	prefix := r.serializePrefix(entity)
+	if r.secretChecksum != "" {
+		payload = binary.BigEndian.AppendUint32(payload, secretChecksum(prefix, payload))
+	}
+	return Secret{entity, prefix, r.separator, fmt.Sprintf("%s%s%s", prefix, r.separator, r.encode(payload))}, nil
+}
+
+// ParseSecret parses a token presented by a client. Errors never include
+// the token.
+func (r *Registry) ParseSecret(token string) (Secret, error) {
+	entity, payload, err := r.decodePayload(token)
+	if err != nil {
+		// decodePayload errors never quote the payload.
+		return Secret{}, err
+	}
+	// decodePayload has already validated the token.
+	prefix, _, _ := r.splitID(token)
+	if err := r.checkSecretPayload(entity, prefix, payload); err != nil {
+		return Secret{}, err
+	}
+	return Secret{entity, prefix, r.separator, token}, nil
+}
+
+// WithSecretChecksums appends a CRC32 checksum of the prefix and the random
+// bytes to secret tokens, so secret scanners can tell real tokens from
+// lookalikes without access to stored hashes. It changes the length of
+// secret tokens, and tokens generated without checksums are rejected.
+func (r *Registry) WithSecretChecksums() (*Registry, error) {
+	previous := r.secretChecksum
+	r.secretChecksum = SecretChecksumCRC32
+	if isPayloadChar(r.separator) {
+		if err := r.checkFixedLengthAmbiguity(r.separator); err != nil {
+			r.secretChecksum = previous
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// secretPayloadLen returns the number of bytes in the payload of secret
+// tokens.
+func (r *Registry) secretPayloadLen() int {
+	if r.secretChecksum != "" {
+		return secretLen + secretChecksumLen
+	}
+	return secretLen
+}
+
+// checkSecretPayload validates the decoded payload of a token of entity
+// with the given prefix.
+func (r *Registry) checkSecretPayload(entity Entity, prefix string, payload []byte) error {
+	if !r.secrets[entity] {
+		return fmt.Errorf("%w: %q is not a secret prefix", ErrInvalidSecret, prefix)
+	}
+	if len(payload) != r.secretPayloadLen() {
+		return fmt.Errorf("%w: %q token has the wrong length", ErrInvalidSecret, prefix)
+	}
+	if r.secretChecksum != "" && binary.BigEndian.Uint32(payload[secretLen:]) != secretChecksum(prefix, payload[:secretLen]) {
+		return fmt.Errorf("%w: %q token has an invalid checksum", ErrInvalidSecret, prefix)
+	}
+	return nil
+}
+
+// secretChecksum returns the CRC32 (IEEE) of the prefix followed by the
+// random bytes of a token.
+func secretChecksum(prefix string, random []byte) uint32 {
+	crc := crc32.ChecksumIEEE([]byte(prefix))
+	return crc32.Update(crc, crc32.IEEETable, random)
+}
+
+// VerifySecret checks a presented token against a hash stored with
+// Secret.Hash and returns the entity of the token. Hashes are compared in
+// constant time, and ErrSecretMismatch is returned if they differ.
+func (r *Registry) VerifySecret(token string, hash string) (Entity, error) {
+	secret, err := r.ParseSecret(token)
+	if err != nil {
+		return NullEntity, err
+	}
+	if subtle.ConstantTimeCompare([]byte(secret.Hash()), []byte(hash)) != 1 {
+		return NullEntity, fmt.Errorf("%w", ErrSecretMismatch)
+	}
+	return secret.entity, nil
+}
+
+// Entity returns the entity of the secret.
+func (s Secret) Entity() Entity {
+	return s.entity
+}
+
+// Reveal returns the token, which should only be shown to its owner once
+// and never be stored or logged.
+func (s Secret) Reveal() string {
+	return s.token
+}
+
+// Hash returns the form of the secret to store, e.g.
+// "sk_live:sha256:<hex>". Tokens have 256 bits of entropy, so a single
+// SHA-256 is enough and verifying stays cheap. The prefix is kept in clear
+// to tell stored hashes apart.
+func (s Secret) Hash() string {
+	sum := sha256.Sum256([]byte(s.token))
+	return s.prefix + ":" + secretHashScheme + ":" + hex.EncodeToString(sum[:])
+}
+
+// String returns the prefix of the secret followed by a redacted payload.
+func (s Secret) String() string {
+	return s.prefix + s.separator + "[REDACTED]"
+}
+
+// GoString implements fmt.GoStringer so that %#v is redacted as well.
+func (s Secret) GoString() string {
+	return fmt.Sprintf("prefixed_uuids.Secret{%q}", s.String())
+}
@@ -0,0 +1,164 @@
+package prefixed_uuids
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func newSecretRegistry(t *testing.T) *Registry {
+	t.Helper()
+	r := newEnvironmentRegistry(t, EnvironmentLive)
+	r, err := r.WithSecrets(SecretKey)
+	assert.NoError(t, err)
+	return r
+}
+
+func TestSecretRoundTrip(t *testing.T) {
+	r := newSecretRegistry(t)
+	secret, err := r.GenerateSecret(SecretKey)
+	assert.NoError(t, err)
+	assert.Equal(t, SecretKey, secret.Entity())
+
+	token := secret.Reveal()
+	assert.True(t, strings.HasPrefix(token, "sk_live."))
+	assert.Len(t, token, len("sk_live.")+base64withNoPadding.EncodedLen(secretLen))
+
+	other, err := r.GenerateSecret(SecretKey)
+	assert.NoError(t, err)
+	assert.NotEqual(t, token, other.Reveal())
+
+	hash := secret.Hash()
+	assert.True(t, strings.HasPrefix(hash, "sk_live:sha256:"))
+	assert.Len(t, hash, len("sk_live:sha256:")+64)
+	assert.NotContains(t, hash, strings.TrimPrefix(token, "sk_live."))
+
+	entity, err := r.VerifySecret(token, hash)
+	assert.NoError(t, err)
+	assert.Equal(t, SecretKey, entity)
+
+	parsed, err := r.ParseSecret(token)
+	assert.NoError(t, err)
+	assert.Equal(t, hash, parsed.Hash())
+
+	_, err = r.VerifySecret(other.Reveal(), hash)
+	assert.ErrorIs(t, err, ErrSecretMismatch)
+	_, err = r.VerifySecret(token, "")
+	assert.ErrorIs(t, err, ErrSecretMismatch)
+}
+
+func TestSecretRedaction(t *testing.T) {
+	r := newSecretRegistry(t)
+	secret, err := r.GenerateSecret(SecretKey)
+	assert.NoError(t, err)
+	payload := strings.TrimPrefix(secret.Reveal(), "sk_live.")
+
+	for _, format := range []string{"%v", "%+v", "%#v", "%s", "%q", "%x"} {
+		out := fmt.Sprintf(format, secret)
+		assert.NotContains(t, out, payload, format)
+		assert.NotContains(t, out, fmt.Sprintf("%x", payload), format)
+	}
+	assert.Equal(t, "sk_live.[REDACTED]", secret.String())
+	assert.Equal(t, `prefixed_uuids.Secret{"sk_live.[REDACTED]"}`, fmt.Sprintf("%#v", secret))
+	assert.Equal(t, "[sk_live.[REDACTED]]", fmt.Sprint([]Secret{secret}))
+
+	// Errors about presented tokens don't quote them either.
+	tampered := secret.Reveal()[:len(secret.Reveal())-1] + "!"
+	for _, token := range []string{
+		"sk_live." + payload[:20],
+		tampered,
+		"sk_test." + payload,
+		"nope." + payload,
+		"user." + payload,
+		payload,
+	} {
+		_, err := r.VerifySecret(token, secret.Hash())
+		assert.Error(t, err, token)
+		assert.NotContains(t, err.Error(), payload[:20], token)
+	}
+}
+
+func TestSecretErrors(t *testing.T) {
+	r := newSecretRegistry(t)
+	secret, err := r.GenerateSecret(SecretKey)
+	assert.NoError(t, err)
+
+	_, err = r.Deserialize(SecretKey, secret.Reveal())
+	assert.ErrorIs(t, err, ErrInvalidSecret)
+	_, err = r.ParseSecret("user.AZXje_k_dRiprKK-aEY8fg")
+	assert.ErrorIs(t, err, ErrInvalidSecret)
+	_, err = r.ParseSecret("sk_live.AZXje_k_dRiprKK-aEY8fg")
+	assert.ErrorIs(t, err, ErrInvalidSecret)
+	_, err = r.ParseSecret("sk_test" + strings.TrimPrefix(secret.Reveal(), "sk_live"))
+	assert.ErrorIs(t, err, ErrEnvironmentMismatch)
+	_, err = r.GenerateSecret(User)
+	assert.ErrorIs(t, err, ErrInvalidSecret)
+
+	_, err = r.WithSecrets(UserPost)
+	assert.ErrorContains(t, err, "entity 10 is not registered")
+	_, err = r.SerializeForEnvironment(SecretKey, EnvironmentTest, uuid.New())
+	assert.ErrorIs(t, err, ErrInvalidSecret)
+	scoped, err := mustRegistry(t, []PrefixInfo{{Post, "post"}}, nil).WithTenantScope(tenantKey, Post)
+	assert.NoError(t, err)
+	_, err = scoped.WithSecrets(Post)
+	assert.ErrorContains(t, err, "tenant scoped and cannot be secret")
+	_, err = r.WithTenantScope(tenantKey, SecretKey)
+	assert.ErrorContains(t, err, "secret and cannot be tenant scoped")
+
+	// Secret tokens are longer than UUIDs, which fixed-length separators
+	// take into account.
+	r, err = r.WithSeparator("_")
+	assert.NoError(t, err)
+	secret, err = r.GenerateSecret(SecretKey)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(secret.Reveal(), "sk_live_"))
+	_, err = r.VerifySecret(secret.Reveal(), secret.Hash())
+	assert.NoError(t, err)
+	assert.Equal(t, "sk_live_[REDACTED]", secret.String())
+}
+
+func TestSecretRejectedAsUUID(t *testing.T) {
+	// Bare prefixes must reach the secret check.
+	r, err := newSecretRegistry(t).WithBareEnvironmentIDs()
+	assert.NoError(t, err)
+	secret, err := r.GenerateSecret(SecretKey)
+	assert.NoError(t, err)
+
+	// Neither tokens nor UUID sized payloads with a secret prefix are
+	// decoded as UUIDs.
+	for _, id := range []string{secret.Reveal(), "sk.AZXje_k_dRiprKK-aEY8fg", "sk_live.AZXje_k_dRiprKK-aEY8fg"} {
+		_, _, err = r.DeserializeOneOf(id, SecretKey, User)
+		assert.ErrorIs(t, err, ErrInvalidSecret)
+		_, _, err = r.DeserializeAny(id)
+		assert.ErrorIs(t, err, ErrInvalidSecret)
+		_, _, err = r.DeserializeWithEntity(id)
+		assert.ErrorIs(t, err, ErrInvalidSecret)
+	}
+
+	// Composite IDs hold plain UUIDs, so secret entities can't be their
+	// components.
+	_, err = r.WithMulti(MultiPrefixInfo{UserPost, "up", []Entity{User, SecretKey}})
+	assert.ErrorContains(t, err, "entity 41 is secret and cannot be a component")
+	_, err = r.WithLists(ListPrefixInfo{PostSelection, "keys", SecretKey, 1, 3})
+	assert.ErrorContains(t, err, "entity 41 is secret and cannot be a component")
+	_, err = r.WithUnions(UnionInfo{AnyUser, []Entity{User, SecretKey}})
+	assert.ErrorContains(t, err, "entity 41 is secret and cannot be a component")
+
+	withMulti := mustRegistry(t, []PrefixInfo{{User, "user"}, {SecretKey, "sk"}}, []MultiPrefixInfo{{UserPost, "up", []Entity{User, SecretKey}}})
+	_, err = withMulti.WithSecrets(SecretKey)
+	assert.ErrorContains(t, err, "entity 41 is a component of a multi, list or union type")
+}
+
+func TestSecretDefinition(t *testing.T) {
+	def := newSecretRegistry(t).Definition()
+	assert.Equal(t, []Entity{SecretKey}, def.Secrets)
+	assert.Contains(t, string(def.Canonical()), "\nsecrets 41\n")
+
+	public := def
+	public.Secrets = nil
+	assert.Equal(t, []string{"breaking: entity 41 became secret"}, changeMessages(CheckCompatibility(public, def)))
+	assert.Equal(t, []string{"breaking: entity 41 is no longer secret"}, changeMessages(CheckCompatibility(def, public)))
+}
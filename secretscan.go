@@ -0,0 +1,206 @@
+package prefixed_uuids
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// payloadCharClass matches a character of a base64url payload, and
+// typeIDCharClass one of a TypeID suffix.
+const (
+	payloadCharClass = `[0-9A-Za-z_-]`
+	typeIDCharClass  = `[0-9a-z]`
+)
+
+// boundaryClass matches a character which can't be part of an ID, so an
+// ID must be preceded and followed by one, or by the start or end of the
+// text.
+const boundaryClass = `[^0-9A-Za-z_-]`
+
+// Pattern is a regular expression matching the IDs of a registered prefix,
+// e.g. for secret scanning services or pre-commit hooks. The ID is captured
+// by the first group, the rest of the match is the character before and
+// after it.
+type Pattern struct {
+	Entity Entity `json:"entity"`
+	Prefix string `json:"prefix"`
+	Secret bool   `json:"secret"`
+	Regex  string `json:"regex"`
+}
+
+// Patterns returns a Pattern per registered prefix, including aliases and
+// environment prefixes, sorted by prefix. Payloads are matched by length
+// and alphabet, so patterns for secret entities with checksums are the
+// most specific; use Scan to also verify the checksums. Patterns of multi
+// types with compression match any payload up to the uncompressed length.
+func (r *Registry) Patterns() []Pattern {
+	patterns := make([]Pattern, 0, len(r.reverse))
+	for prefix, entity := range r.reverse {
+		patterns = append(patterns, Pattern{
+			Entity: entity,
+			Prefix: prefix,
+			Secret: r.secrets[entity],
+			Regex:  "(?:^|" + boundaryClass + ")(" + r.idPattern(entity, regexp.QuoteMeta(prefix)) + ")(?:" + boundaryClass + "|$)",
+		})
+	}
+	sort.Slice(patterns, func(i, j int) bool { return patterns[i].Prefix < patterns[j].Prefix })
+	return patterns
+}
+
+// idPattern returns the pattern of IDs of entity with the given quoted
+// prefix, or alternation of prefixes, without boundaries.
+func (r *Registry) idPattern(entity Entity, prefix string) string {
+	class := payloadCharClass
+	if r.encoding == EncodingTypeID {
+		class = typeIDCharClass
+	}
+	lengths := r.entityPayloadLengths(entity)
+	if r.encoding == EncodingTypeID {
+		lengths = []int{typeIDSuffixLength}
+	}
+	slices.Sort(lengths)
+	var payload string
+	switch {
+	case r.compression != "" && !r.isList(entity) && r.isComposite(entity):
+		payload = fmt.Sprintf("%s{1,%d}", class, lengths[len(lengths)-1])
+	case len(lengths) == 1:
+		payload = fmt.Sprintf("%s{%d}", class, lengths[0])
+	default:
+		// Longest first, so that a shorter length doesn't match a prefix
+		// of a longer payload.
+		alternatives := make([]string, len(lengths))
+		for i, l := range lengths {
+			alternatives[len(lengths)-1-i] = fmt.Sprintf("%s{%d}", class, l)
+		}
+		payload = "(?:" + strings.Join(alternatives, "|") + ")"
+	}
+	return "(?:" + prefix + ")" + regexp.QuoteMeta(r.separator) + payload
+}
+
+// SecretFinding is a valid secret token found by Scan.
+type SecretFinding struct {
+	// Line is the 1-based line number of the token.
+	Line int
+	// Offset is the byte offset of the token from the start of the input.
+	Offset int64
+	// Secret is the token, whose String method redacts it.
+	Secret Secret
+}
+
+// Scan reads rd and returns the secret tokens it contains, e.g. in a CI job
+// checking commits for leaked API keys. Candidates matching the pattern of
+// a secret prefix are validated like ParseSecret does, including their
+// checksum, so lookalikes are skipped. Tokens of every environment are
+// reported regardless of the registry's environment.
+func (r *Registry) Scan(rd io.Reader) ([]SecretFinding, error) {
+	re := r.secretRegexp()
+	if re == nil {
+		return nil, nil
+	}
+
+	var findings []SecretFinding
+	br := bufio.NewReader(rd)
+	var offset int64
+	for line := 1; ; line++ {
+		text, err := br.ReadString('\n')
+		for _, loc := range findCandidates(re, text) {
+			if secret, ok := r.scanSecret(text[loc[0]:loc[1]]); ok {
+				findings = append(findings, SecretFinding{line, offset + int64(loc[0]), secret})
+			}
+		}
+		offset += int64(len(text))
+		if errors.Is(err, io.EOF) {
+			return findings, nil
+		}
+		if err != nil {
+			return findings, err
+		}
+	}
+}
+
+// findCandidates returns the locations of the matches of re in text which
+// are delimited by boundaries, i.e. which aren't part of a longer ID.
+func findCandidates(re *regexp.Regexp, text string) [][]int {
+	var candidates [][]int
+	for _, loc := range re.FindAllStringIndex(text, -1) {
+		if isIDBoundary(text, loc[0]-1) && isIDBoundary(text, loc[1]) {
+			candidates = append(candidates, loc)
+		}
+	}
+	return candidates
+}
+
+// compile compiles pattern, reusing the result of earlier calls, since the
+// patterns only change when the registry is reconfigured.
+func (r *Registry) compile(pattern string) *regexp.Regexp {
+	if re, ok := r.regexps.Load(pattern); ok {
+		return re.(*regexp.Regexp)
+	}
+	re := regexp.MustCompile(pattern)
+	r.regexps.Store(pattern, re)
+	return re
+}
+
+// secretRegexp returns the pattern matching the tokens of all secret
+// prefixes, without boundaries, or nil if there are no secret entities.
+func (r *Registry) secretRegexp() *regexp.Regexp {
+	var prefixes []string
+	secret := NullEntity
+	for prefix, entity := range r.reverse {
+		if r.secrets[entity] {
+			prefixes = append(prefixes, regexp.QuoteMeta(prefix))
+			secret = entity
+		}
+	}
+	if len(prefixes) == 0 {
+		return nil
+	}
+	sortLongestFirst(prefixes)
+	// All secret entities have payloads of the same length.
+	return r.compile(r.idPattern(secret, strings.Join(prefixes, "|")))
+}
+
+// scanSecret validates a candidate token. Unlike ParseSecret, tokens of any
+// environment are accepted.
+func (r *Registry) scanSecret(token string) (Secret, bool) {
+	prefix, encoded, err := r.splitID(token)
+	if err != nil {
+		return Secret{}, false
+	}
+	entity, ok := r.reverse[prefix]
+	if !ok {
+		return Secret{}, false
+	}
+	payload, err := r.decode(encoded)
+	if err != nil || r.checkSecretPayload(entity, prefix, payload) != nil {
+		return Secret{}, false
+	}
+	return Secret{entity, prefix, r.separator, token}, true
+}
+
+// isIDBoundary reports whether the byte of text at i, which may be out of
+// range, can't be part of an ID.
+func isIDBoundary(text string, i int) bool {
+	if i < 0 || i >= len(text) {
+		return true
+	}
+	c := text[i]
+	return !(c >= '0' && c <= '9' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c == '_' || c == '-')
+}
+
+// sortLongestFirst sorts prefixes by descending length, so that e.g.
+// "sk_live" is tried before "sk" in an alternation.
+func sortLongestFirst(prefixes []string) {
+	sort.Slice(prefixes, func(i, j int) bool {
+		if len(prefixes[i]) != len(prefixes[j]) {
+			return len(prefixes[i]) > len(prefixes[j])
+		}
+		return prefixes[i] < prefixes[j]
+	})
+}
@@ -0,0 +1,125 @@
+package prefixed_uuids
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newChecksumRegistry(t *testing.T) *Registry {
+	t.Helper()
+	r, err := newSecretRegistry(t).WithSecretChecksums()
+	assert.NoError(t, err)
+	return r
+}
+
+func TestSecretChecksums(t *testing.T) {
+	r := newChecksumRegistry(t)
+	secret, err := r.GenerateSecret(SecretKey)
+	assert.NoError(t, err)
+	token := secret.Reveal()
+	assert.Len(t, token, len("sk_live.")+base64withNoPadding.EncodedLen(secretLen+secretChecksumLen))
+	_, err = r.VerifySecret(token, secret.Hash())
+	assert.NoError(t, err)
+
+	// Flipping a bit of the random part breaks the checksum.
+	payload, err := base64withNoPadding.DecodeString(strings.TrimPrefix(token, "sk_live."))
+	assert.NoError(t, err)
+	payload[0] ^= 1
+	_, err = r.ParseSecret("sk_live." + base64withNoPadding.EncodeToString(payload))
+	assert.ErrorIs(t, err, ErrInvalidSecret)
+	assert.ErrorContains(t, err, "invalid checksum")
+
+	// The checksum covers the prefix.
+	payload[0] ^= 1
+	test, err := newChecksumRegistry(t).WithEnvironment(EnvironmentTest)
+	assert.NoError(t, err)
+	_, err = test.ParseSecret("sk_test." + base64withNoPadding.EncodeToString(payload))
+	assert.ErrorContains(t, err, "invalid checksum")
+
+	// Tokens without checksums have a different length.
+	plain, err := newSecretRegistry(t).GenerateSecret(SecretKey)
+	assert.NoError(t, err)
+	_, err = r.ParseSecret(plain.Reveal())
+	assert.ErrorIs(t, err, ErrInvalidSecret)
+
+	def := r.Definition()
+	assert.Equal(t, SecretChecksumCRC32, def.SecretChecksum)
+	assert.Contains(t, string(def.Canonical()), "\nsecrets 41\nsecret_checksum crc32\n")
+	unchecked := def
+	unchecked.SecretChecksum = ""
+	assert.Equal(t, []string{`breaking: secret checksum changed from "" to "crc32"`}, changeMessages(CheckCompatibility(unchecked, def)))
+}
+
+func TestPatterns(t *testing.T) {
+	r := newChecksumRegistry(t)
+	r, err := r.WithLists(ListPrefixInfo{PostSelection, "posts", User, 1, 2})
+	assert.NoError(t, err)
+
+	patterns := r.Patterns()
+	var prefixes []string
+	for _, p := range patterns {
+		prefixes = append(prefixes, p.Prefix)
+		_, err := regexp.Compile(p.Regex)
+		assert.NoError(t, err, p.Prefix)
+	}
+	assert.Equal(t, []string{"posts", "sk", "sk_live", "sk_test", "user"}, prefixes)
+	assert.Equal(t, Pattern{User, "user", false, `(?:^|[^0-9A-Za-z_-])((?:user)\.[0-9A-Za-z_-]{22})(?:[^0-9A-Za-z_-]|$)`}, patterns[4])
+	assert.Equal(t, Pattern{SecretKey, "sk_live", true, `(?:^|[^0-9A-Za-z_-])((?:sk_live)\.[0-9A-Za-z_-]{48})(?:[^0-9A-Za-z_-]|$)`}, patterns[2])
+	assert.Equal(t, `(?:^|[^0-9A-Za-z_-])((?:posts)\.(?:[0-9A-Za-z_-]{43}|[0-9A-Za-z_-]{22}))(?:[^0-9A-Za-z_-]|$)`, patterns[0].Regex)
+
+	secret, err := r.GenerateSecret(SecretKey)
+	assert.NoError(t, err)
+	re := regexp.MustCompile(patterns[2].Regex)
+	match := re.FindStringSubmatch(`API_KEY="` + secret.Reveal() + `"`)
+	assert.Equal(t, secret.Reveal(), match[1])
+	assert.False(t, re.MatchString("x"+secret.Reveal()))
+	assert.False(t, re.MatchString(secret.Reveal()+"x"))
+
+	typeID, err := mustRegistry(t, []PrefixInfo{{User, "user"}}, nil).WithTypeID()
+	assert.NoError(t, err)
+	assert.Equal(t, `(?:^|[^0-9A-Za-z_-])((?:user)_[0-9a-z]{26})(?:[^0-9A-Za-z_-]|$)`, typeID.Patterns()[0].Regex)
+}
+
+func TestScan(t *testing.T) {
+	r := newChecksumRegistry(t)
+	live, err := r.GenerateSecret(SecretKey)
+	assert.NoError(t, err)
+	// An ID with a UUID payload isn't a token.
+	uuidID := "sk_test." + base64withNoPadding.EncodeToString(make([]byte, 16))
+	testR, err := newChecksumRegistry(t).WithEnvironment(EnvironmentTest)
+	assert.NoError(t, err)
+	testSecret, err := testR.GenerateSecret(SecretKey)
+	assert.NoError(t, err)
+
+	// A lookalike with the right length and alphabet but a bad checksum.
+	payload, err := base64withNoPadding.DecodeString(strings.TrimPrefix(live.Reveal(), "sk_live."))
+	assert.NoError(t, err)
+	payload[0] ^= 1
+	lookalike := "sk_live." + base64withNoPadding.EncodeToString(payload)
+
+	input := "config:\n" +
+		"  key: " + live.Reveal() + "\n" +
+		"  uuid_id: " + uuidID + "\n" +
+		"  fake: " + lookalike + "\n" +
+		"  embedded: x" + live.Reveal() + "\n" +
+		testSecret.Reveal() + "," + live.Reveal()
+	findings, err := r.Scan(strings.NewReader(input))
+	assert.NoError(t, err)
+
+	assert.Len(t, findings, 3)
+	assert.Equal(t, 2, findings[0].Line)
+	assert.Equal(t, int64(strings.Index(input, live.Reveal())), findings[0].Offset)
+	assert.Equal(t, live.Hash(), findings[0].Secret.Hash())
+	// Test tokens are found by live registries too.
+	assert.Equal(t, 6, findings[1].Line)
+	assert.Equal(t, testSecret.Hash(), findings[1].Secret.Hash())
+	assert.Equal(t, 6, findings[2].Line)
+	assert.Equal(t, int64(strings.LastIndex(input, live.Reveal())), findings[2].Offset)
+
+	findings, err = mustRegistry(t, []PrefixInfo{{User, "user"}}, nil).Scan(strings.NewReader(input))
+	assert.NoError(t, err)
+	assert.Empty(t, findings)
+}
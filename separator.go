@@ -0,0 +1,128 @@
+package prefixed_uuids
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// isPayloadChar reports whether separator is part of the base64url
+// alphabet, in which case IDs cannot simply be split on it.
+func isPayloadChar(separator string) bool {
+	return separator == "_" || separator == "-"
+}
+
+// entityPayloadLengths returns the possible lengths of the encoded payload
+// of entity.
+func (r *Registry) entityPayloadLengths(entity Entity) []int {
+	if list, ok := r.lists[entity]; ok {
+		lengths := make([]int, 0, list.Max-list.Min+1)
+		for n := list.Min; n <= list.Max; n++ {
+			lengths = append(lengths, base64withNoPadding.EncodedLen(16*n))
+		}
+		return lengths
+	}
+	if _, ok := r.multi[entity]; ok {
+		lengths := r.multiPayloadLengths(r.flatComponents(entity))
+		for i, l := range lengths {
+			lengths[i] = base64withNoPadding.EncodedLen(l)
+		}
+		return lengths
+	}
+	if r.secrets[entity] {
+		return []int{base64withNoPadding.EncodedLen(r.secretPayloadLen())}
+	}
+	if r.tenantScoped[entity] {
+		return []int{base64withNoPadding.EncodedLen(16 + tenantMACLen)}
+	}
+	return []int{base64withNoPadding.EncodedLen(16)}
+}
+
+// payloadLengths returns the distinct encoded payload lengths of all
+// registered prefixes in ascending order.
+func (r *Registry) payloadLengths() []int {
+	seen := make(map[int]bool)
+	var lengths []int
+	for _, entity := range r.reverse {
+		for _, l := range r.entityPayloadLengths(entity) {
+			if !seen[l] {
+				seen[l] = true
+				lengths = append(lengths, l)
+			}
+		}
+	}
+	sort.Ints(lengths)
+	return lengths
+}
+
+// splitFixedLength splits an ID whose separator may also appear in the
+// payload or the prefix. Payloads have a fixed length per entity, so the
+// payload is peeled off the right and the remainder is matched against the
+// registered prefixes.
+func (r *Registry) splitFixedLength(uuidStr string) (string, string, error) {
+	unknown := false
+	for _, l := range r.payloadLengths() {
+		at := len(uuidStr) - l - 1
+		if at < 1 || uuidStr[at:at+1] != r.separator {
+			continue
+		}
+		prefix := uuidStr[:at]
+		entity, ok := r.reverse[prefix]
+		if !ok {
+			unknown = true
+			continue
+		}
+		if slices.Contains(r.entityPayloadLengths(entity), l) {
+			return prefix, uuidStr[at+1:], nil
+		}
+	}
+	if unknown {
+		return "", "", fmt.Errorf("%w", ErrUnknownPrefix)
+	}
+
+	// The payload has the wrong length. Return the longest matching prefix
+	// so that decoding the payload reports a meaningful error.
+	longest := ""
+	for prefix := range r.reverse {
+		if len(prefix) > len(longest) && strings.HasPrefix(uuidStr, prefix+r.separator) {
+			longest = prefix
+		}
+	}
+	if longest != "" {
+		return longest, uuidStr[len(longest)+1:], nil
+	}
+	if !strings.Contains(uuidStr, r.separator) {
+		return "", "", fmt.Errorf("%w", ErrInvalidPrefixedUUIDFormat)
+	}
+	return "", "", fmt.Errorf("%w", ErrUnknownPrefix)
+}
+
+// checkFixedLengthAmbiguity returns an error if some string could be parsed
+// as IDs of two different prefixes when using separator. That happens when
+// a longer prefix starts with a shorter prefix followed by the separator and
+// the difference in prefix lengths equals the difference in payload lengths.
+// Lists have several possible payload lengths, all of which are checked.
+func (r *Registry) checkFixedLengthAmbiguity(separator string) error {
+	prefixes := make([]string, 0, len(r.reverse))
+	for prefix := range r.reverse {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	for _, short := range prefixes {
+		for _, long := range prefixes {
+			if !strings.HasPrefix(long, short+separator) {
+				continue
+			}
+			for _, shortLen := range r.entityPayloadLengths(r.reverse[short]) {
+				for _, longLen := range r.entityPayloadLengths(r.reverse[long]) {
+					if len(long)-len(short) == shortLen-longLen {
+						return fmt.Errorf("%w: prefixes %q and %q are ambiguous with separator %q", ErrInvalidSeparator, short, long, separator)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
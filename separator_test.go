@@ -0,0 +1,89 @@
+package prefixed_uuids
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPayloadCharSeparators(t *testing.T) {
+	// This UUID encodes to a payload containing both '_' and '-'.
+	u := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+	postUUID := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7f")
+
+	for _, sep := range []string{"_", "-"} {
+		t.Run(sep, func(t *testing.T) {
+			r := mustRegistry(t,
+				[]PrefixInfo{{User, "user"}, {UserV2, "user_v2"}, {Post, "post"}, {Comment, "cus-tomer"}},
+				[]MultiPrefixInfo{{UserPost, "up", []Entity{User, Post}}},
+			)
+			r, err := r.WithSeparator(sep)
+			assert.NoError(t, err)
+
+			for _, entity := range []Entity{User, UserV2, Post, Comment} {
+				id := r.Serialize(entity, u)
+				assert.Equal(t, r.prefixes[entity]+sep+"AZXje_k_dRiprKK-aEY8fg", id)
+
+				parsedEntity, parsed, err := r.DeserializeWithEntity(id)
+				assert.NoError(t, err)
+				assert.Equal(t, entity, parsedEntity)
+				assert.Equal(t, u, parsed)
+			}
+
+			encoded, err := r.SerializeMulti(UserPost, EntityUUID{User, u}, EntityUUID{Post, postUUID})
+			assert.NoError(t, err)
+			var parsedUser, parsedPost uuid.UUID
+			err = r.DeserializeMulti(UserPost, encoded, EntityUUIDPtr{User, &parsedUser}, EntityUUIDPtr{Post, &parsedPost})
+			assert.NoError(t, err)
+			assert.Equal(t, u, parsedUser)
+			assert.Equal(t, postUUID, parsedPost)
+		})
+	}
+}
+
+func TestPayloadCharSeparatorErrors(t *testing.T) {
+	r := mustRegistry(t,
+		[]PrefixInfo{{User, "user"}, {Post, "post"}},
+		[]MultiPrefixInfo{{UserPost, "up", []Entity{User, Post}}},
+	)
+	r, err := r.WithSeparator("_")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		input         string
+		expectedError error
+	}{
+		{"empty string", "", ErrInvalidPrefixedUUIDFormat},
+		{"no separator", "userAZXje0k0dRiprKK0aEY8fg", ErrInvalidPrefixedUUIDFormat},
+		{"unknown prefix", "unknown_AZXje_k_dRiprKK-aEY8fg", ErrUnknownPrefix},
+		{"unknown prefix sharing a registered prefix", "user_v9_AZXje_k_dRiprKK-aEY8fg", ErrUnknownPrefix},
+		{"invalid base64", "user_invalid-base64!", ErrInvalidUUIDBadBase64},
+		{"too short", "user_AAAAAA", ErrInvalidUUIDFormat},
+		{"multi payload for single entity", "user_AZXje_k_dRiprKK-aEY8fgGV43v5P3UYqayivmhGPH8", ErrInvalidUUIDFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := r.DeserializeWithEntity(tt.input)
+			assert.ErrorIs(t, err, tt.expectedError)
+		})
+	}
+}
+
+func TestPayloadCharSeparatorAmbiguity(t *testing.T) {
+	// "up" has a 43 character payload, so "up_" followed by 20 characters
+	// and a 22 character payload could also be read as an "up" ID.
+	r := mustRegistry(t,
+		[]PrefixInfo{{User, "user"}, {Post, "post"}, {Other, "up_abcdefghijklmnopqrst"}},
+		[]MultiPrefixInfo{{UserPost, "up", []Entity{User, Post}}},
+	)
+	_, err := r.WithSeparator("_")
+	assert.ErrorIs(t, err, ErrInvalidSeparator)
+	assert.Contains(t, err.Error(), "ambiguous")
+
+	// The registry is left unchanged, and other separators are fine.
+	assert.Equal(t, ".", r.separator)
+	_, err = r.WithSeparator("-")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,140 @@
+package prefixed_uuids
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+// tenantMACLen is the number of bytes of the HMAC-SHA256 appended to the
+// UUID of tenant scoped IDs.
+const tenantMACLen = 8
+
+// minTenantKeyLen is the minimum length of the key passed to
+// WithTenantScope.
+const minTenantKeyLen = 16
+
+// WithTenantScope makes IDs of the given entities tenant scoped. Their
+// payload is the UUID followed by a truncated HMAC-SHA256 of the entity,
+// the UUID and the tenant, keyed with key, so an ID issued to one tenant
+// is rejected with ErrTenantMismatch when presented by another.
+//
+// Scoped IDs are created with SerializeForTenant and parsed with
+// DeserializeForTenant. Serialize must not be used for scoped entities,
+// since the unscoped IDs it returns are rejected by every Deserialize
+// method, and scoped IDs are only accepted by DeserializeForTenant. Scoped
+// entities can't be components of multi, list or union types, whose IDs
+// have no room for a MAC. IDs of other entities are not affected.
+//
+// The key must be at least 16 bytes, must be the same for every call and
+// is not part of the Definition, so rotating it silently invalidates all
+// scoped IDs.
+func (r *Registry) WithTenantScope(key []byte, entities ...Entity) (*Registry, error) {
+	if r.encoding == EncodingTypeID {
+		return nil, fmt.Errorf("tenant scoped entities are not supported by typeid registries")
+	}
+	if len(key) < minTenantKeyLen {
+		return nil, fmt.Errorf("tenant key must be at least %d bytes, got %d", minTenantKeyLen, len(key))
+	}
+	if r.tenantKey != nil && !hmac.Equal(r.tenantKey, key) {
+		return nil, fmt.Errorf("tenant key is already set to a different key")
+	}
+	for _, entity := range entities {
+		if _, ok := r.prefixes[entity]; !ok || r.isComposite(entity) {
+			return nil, fmt.Errorf("entity %d is not registered in the registry", entity)
+		}
+		if r.secrets[entity] {
+			return nil, fmt.Errorf("entity %d is secret and cannot be tenant scoped", entity)
+		}
+		if r.isComponent(entity) {
+			return nil, fmt.Errorf("entity %d is a component of a multi, list or union type and cannot be tenant scoped", entity)
+		}
+	}
+
+	added := make([]Entity, 0, len(entities))
+	if r.tenantScoped == nil {
+		r.tenantScoped = make(map[Entity]bool)
+	}
+	for _, entity := range entities {
+		if !r.tenantScoped[entity] {
+			r.tenantScoped[entity] = true
+			added = append(added, entity)
+		}
+	}
+	if isPayloadChar(r.separator) {
+		if err := r.checkFixedLengthAmbiguity(r.separator); err != nil {
+			for _, entity := range added {
+				delete(r.tenantScoped, entity)
+			}
+			return nil, err
+		}
+	}
+	r.tenantKey = bytes.Clone(key)
+	return r, nil
+}
+
+// SerializeForTenant is like Serialize but binds the ID to tenant, e.g. an
+// organization ID. entity must be tenant scoped.
+func (r *Registry) SerializeForTenant(entity Entity, tenant string, u uuid.UUID) (string, error) {
+	if !r.tenantScoped[entity] {
+		return "", fmt.Errorf("%w: entity %d", ErrNotTenantScoped, entity)
+	}
+	if tenant == "" {
+		return "", fmt.Errorf("tenant cannot be empty")
+	}
+	payload := append(u[:], r.tenantMAC(entity, tenant, u)...)
+	return fmt.Sprintf("%s%s%s", r.serializePrefix(entity), r.separator, r.encode(payload)), nil
+}
+
+// DeserializeForTenant is like Deserialize but also requires the ID to have
+// been issued to tenant. IDs issued to other tenants and unscoped IDs
+// return ErrTenantMismatch.
+func (r *Registry) DeserializeForTenant(entity Entity, tenant string, uuidStr string) (uuid.UUID, error) {
+	if !r.tenantScoped[entity] {
+		return uuid.Nil, fmt.Errorf("%w: entity %d", ErrNotTenantScoped, entity)
+	}
+	parsedEntity, payload, err := r.decodePayload(uuidStr)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if parsedEntity != entity {
+		return uuid.Nil, fmt.Errorf("%w", ErrEntityMismatch)
+	}
+	if len(payload) != 16+tenantMACLen {
+		return uuid.Nil, fmt.Errorf("%w: id is not tenant scoped", ErrTenantMismatch)
+	}
+	u, err := uuid.FromBytes(payload[:16])
+	if err != nil {
+		return uuid.Nil, errors.Join(err, ErrInvalidUUIDFormat)
+	}
+	if !hmac.Equal(payload[16:], r.tenantMAC(entity, tenant, u)) {
+		return uuid.Nil, fmt.Errorf("%w", ErrTenantMismatch)
+	}
+	return u, nil
+}
+
+// tenantMAC returns the truncated MAC binding u of entity to tenant. The
+// tenant comes last since it is the only variable length input.
+func (r *Registry) tenantMAC(entity Entity, tenant string, u uuid.UUID) []byte {
+	mac := hmac.New(sha256.New, r.tenantKey)
+	mac.Write(binary.BigEndian.AppendUint64(nil, uint64(entity)))
+	mac.Write(u[:])
+	mac.Write([]byte(tenant))
+	return mac.Sum(nil)[:tenantMACLen]
+}
+
+// sortedEntities returns the entities of set in ascending order.
+func sortedEntities(set map[Entity]bool) []Entity {
+	var entities []Entity
+	for entity := range set {
+		entities = append(entities, entity)
+	}
+	slices.Sort(entities)
+	return entities
+}
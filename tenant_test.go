@@ -0,0 +1,184 @@
+package prefixed_uuids
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+var tenantKey = []byte("0123456789abcdef0123456789abcdef")
+
+func newTenantRegistry(t *testing.T) *Registry {
+	t.Helper()
+	r := mustRegistry(t, []PrefixInfo{{User, "user"}, {Post, "post"}}, nil)
+	r, err := r.WithTenantScope(tenantKey, Post)
+	assert.NoError(t, err)
+	return r
+}
+
+func TestTenantScopeRoundTrip(t *testing.T) {
+	r := newTenantRegistry(t)
+	u := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+
+	id, err := r.SerializeForTenant(Post, "org_a", u)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(id, "post."))
+	assert.Len(t, id, len("post.")+base64withNoPadding.EncodedLen(16+tenantMACLen))
+
+	again, err := r.SerializeForTenant(Post, "org_a", u)
+	assert.NoError(t, err)
+	assert.Equal(t, id, again)
+
+	parsed, err := r.DeserializeForTenant(Post, "org_a", id)
+	assert.NoError(t, err)
+	assert.Equal(t, u, parsed)
+
+	// Other entities keep the unscoped format.
+	assert.Equal(t, "user.AZXje_k_dRiprKK-aEY8fg", r.Serialize(User, u))
+	parsed, err = r.Deserialize(User, "user.AZXje_k_dRiprKK-aEY8fg")
+	assert.NoError(t, err)
+	assert.Equal(t, u, parsed)
+}
+
+func TestTenantScopeMismatch(t *testing.T) {
+	r := newTenantRegistry(t)
+	u := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+	id, err := r.SerializeForTenant(Post, "org_a", u)
+	assert.NoError(t, err)
+
+	_, err = r.DeserializeForTenant(Post, "org_b", id)
+	assert.ErrorIs(t, err, ErrTenantMismatch)
+
+	// A different key is a different issuer.
+	other, err := mustRegistry(t, []PrefixInfo{{Post, "post"}}, nil).WithTenantScope([]byte("fedcba9876543210fedcba9876543210"), Post)
+	assert.NoError(t, err)
+	_, err = other.DeserializeForTenant(Post, "org_a", id)
+	assert.ErrorIs(t, err, ErrTenantMismatch)
+
+	// Swapping the UUID keeps the MAC of the original one.
+	payload, err := base64withNoPadding.DecodeString(strings.TrimPrefix(id, "post."))
+	assert.NoError(t, err)
+	payload[15] ^= 1
+	_, err = r.DeserializeForTenant(Post, "org_a", "post."+base64withNoPadding.EncodeToString(payload))
+	assert.ErrorIs(t, err, ErrTenantMismatch)
+
+	// Unscoped IDs are rejected by DeserializeForTenant and scoped IDs by
+	// Deserialize.
+	_, err = r.DeserializeForTenant(Post, "org_a", r.Serialize(Post, u))
+	assert.ErrorIs(t, err, ErrTenantMismatch)
+	_, err = r.Deserialize(Post, id)
+	assert.ErrorIs(t, err, ErrTenantMismatch)
+	_, _, err = r.DeserializeWithEntity(id)
+	assert.ErrorIs(t, err, ErrTenantMismatch)
+
+	_, err = r.DeserializeForTenant(Post, "org_a", r.Serialize(User, u))
+	assert.ErrorIs(t, err, ErrEntityMismatch)
+	_, err = r.SerializeForTenant(User, "org_a", u)
+	assert.ErrorIs(t, err, ErrNotTenantScoped)
+	_, err = r.DeserializeForTenant(User, "org_a", id)
+	assert.ErrorIs(t, err, ErrNotTenantScoped)
+	_, err = r.SerializeForTenant(Post, "", u)
+	assert.Error(t, err)
+}
+
+func TestTenantScopeForgedIDs(t *testing.T) {
+	r := newTenantRegistry(t)
+	u := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+	scoped, err := r.SerializeForTenant(Post, "org_a", u)
+	assert.NoError(t, err)
+
+	// Dropping the MAC doesn't make an ID acceptable without a tenant, nor
+	// does keeping it.
+	for _, id := range []string{"post.AZXje_k_dRiprKK-aEY8fg", scoped} {
+		_, _, err = r.DeserializeOneOf(id, Post, User)
+		assert.ErrorIs(t, err, ErrTenantMismatch)
+		_, _, err = r.DeserializeAny(id)
+		assert.ErrorIs(t, err, ErrTenantMismatch)
+	}
+	assert.Empty(t, r.FindAll("post.AZXje_k_dRiprKK-aEY8fg"))
+
+	entity, parsed, err := r.DeserializeOneOf("user.AZXje_k_dRiprKK-aEY8fg", Post, User)
+	assert.NoError(t, err)
+	assert.Equal(t, User, entity)
+	assert.Equal(t, u, parsed)
+}
+
+func TestTenantScopeComponents(t *testing.T) {
+	// Composite IDs have no room for a MAC, so scoped entities can't be
+	// their components.
+	r := newTenantRegistry(t)
+	_, err := r.WithMulti(MultiPrefixInfo{UserPost, "up", []Entity{User, Post}})
+	assert.ErrorContains(t, err, "entity 2 is tenant scoped and cannot be a component")
+	_, err = r.WithMulti(MultiPrefixInfo{UserPost, "up", []Entity{User, Optional(Post)}})
+	assert.ErrorContains(t, err, "entity 2 is tenant scoped and cannot be a component")
+	_, err = r.WithLists(ListPrefixInfo{PostSelection, "posts", Post, 1, 3})
+	assert.ErrorContains(t, err, "entity 2 is tenant scoped and cannot be a component")
+	_, err = r.WithUnions(UnionInfo{Commentable, []Entity{User, Post}})
+	assert.ErrorContains(t, err, "entity 2 is tenant scoped and cannot be a component")
+	assert.Empty(t, r.Definition().Multi)
+
+	withMulti := mustRegistry(t, []PrefixInfo{{User, "user"}, {Post, "post"}}, []MultiPrefixInfo{{UserPost, "up", []Entity{User, Post}}})
+	_, err = withMulti.WithTenantScope(tenantKey, Post)
+	assert.ErrorContains(t, err, "entity 2 is a component of a multi, list or union type")
+	_, err = withMulti.WithTenantScope(tenantKey, UserPost)
+	assert.ErrorContains(t, err, "entity 10 is not registered")
+	assert.Empty(t, withMulti.Definition().TenantScoped)
+}
+
+func TestWithTenantScopeValidation(t *testing.T) {
+	tests := []struct {
+		name          string
+		key           []byte
+		entities      []Entity
+		expectedError string
+	}{
+		{"short key", []byte("short"), []Entity{Post}, "at least 16 bytes"},
+		{"different key", []byte("fedcba9876543210fedcba9876543210"), []Entity{User}, "different key"},
+		{"unregistered entity", tenantKey, []Entity{Comment}, "entity 3 is not registered"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTenantRegistry(t)
+			_, err := r.WithTenantScope(tt.key, tt.entities...)
+			assert.ErrorContains(t, err, tt.expectedError)
+			assert.Equal(t, []Entity{Post}, r.Definition().TenantScoped)
+		})
+	}
+
+	_, err := newTenantRegistry(t).WithTypeID()
+	assert.ErrorContains(t, err, "not supported by typeid registries")
+
+	// Scoped payloads are longer, which fixed-length separators take into
+	// account.
+	r := mustRegistry(t, []PrefixInfo{{User, "user"}, {Post, "post"}}, nil)
+	r, err = r.WithSeparator("_")
+	assert.NoError(t, err)
+	r, err = r.WithTenantScope(tenantKey, Post)
+	assert.NoError(t, err)
+	u := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+	id, err := r.SerializeForTenant(Post, "org_a", u)
+	assert.NoError(t, err)
+	parsed, err := r.DeserializeForTenant(Post, "org_a", id)
+	assert.NoError(t, err)
+	assert.Equal(t, u, parsed)
+}
+
+func TestTenantScopeDefinition(t *testing.T) {
+	def := newTenantRegistry(t).Definition()
+	assert.Equal(t, []Entity{Post}, def.TenantScoped)
+	assert.Contains(t, string(def.Canonical()), "\ntenant_scoped 2\n")
+
+	unscoped := def
+	unscoped.TenantScoped = nil
+	assert.NotContains(t, string(unscoped.Canonical()), "tenant_scoped")
+	assert.Equal(t, []string{"breaking: entity 2 became tenant scoped"}, changeMessages(CheckCompatibility(unscoped, def)))
+	assert.Equal(t, []string{"breaking: entity 2 is no longer tenant scoped"}, changeMessages(CheckCompatibility(def, unscoped)))
+
+	// New entities may be scoped from the start.
+	withComment := def
+	withComment.Prefixes = append([]PrefixInfo{{Comment, "comment"}}, def.Prefixes...)
+	withComment.TenantScoped = []Entity{Post, Comment}
+	assert.Equal(t, []string{`safe: new entity 3 with prefix "comment"`}, changeMessages(CheckCompatibility(def, withComment)))
+}
@@ -0,0 +1,127 @@
+package prefixed_uuids
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Match is a valid prefixed ID found in text by FindAll or a Scanner.
+type Match struct {
+	// Offset is the byte offset of the ID from the start of the text.
+	Offset int64
+	// ID is the prefixed ID itself.
+	ID string
+	// Entity is the entity of the ID, and UUIDs its UUIDs as returned by
+	// DeserializeAny: a single pair for plain IDs, and the flattened
+	// components for multi and list IDs.
+	Entity Entity
+	UUIDs  []EntityUUID
+}
+
+// FindAll returns the valid prefixed IDs of registered entities in text,
+// e.g. a log line. Candidates are located by prefix, separator and payload
+// length and then parsed like DeserializeAny does, so lookalikes such as
+// "user.profile" are skipped. Secret tokens and tenant scoped IDs, which
+// can't be validated without more context, are never returned.
+func (r *Registry) FindAll(text string) []Match {
+	return r.findAll(r.idRegexp(), text, 0)
+}
+
+func (r *Registry) findAll(re *regexp.Regexp, text string, offset int64) []Match {
+	if re == nil {
+		return nil
+	}
+	var matches []Match
+	for _, loc := range findCandidates(re, text) {
+		id := text[loc[0]:loc[1]]
+		entity, uuids, err := r.DeserializeAny(id)
+		if err != nil {
+			continue
+		}
+		matches = append(matches, Match{offset + int64(loc[0]), id, entity, uuids})
+	}
+	return matches
+}
+
+// idRegexp returns the pattern matching the IDs of all prefixes FindAll
+// reports, without boundaries, or nil if there are none.
+func (r *Registry) idRegexp() *regexp.Regexp {
+	var prefixes []string
+	for prefix, entity := range r.reverse {
+		if !r.secrets[entity] && !r.tenantScoped[entity] {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	if len(prefixes) == 0 {
+		return nil
+	}
+	sortLongestFirst(prefixes)
+	alternatives := make([]string, len(prefixes))
+	for i, prefix := range prefixes {
+		alternatives[i] = r.idPattern(r.reverse[prefix], regexp.QuoteMeta(prefix))
+	}
+	return r.compile(strings.Join(alternatives, "|"))
+}
+
+// Scanner reads prefixed IDs from a stream, e.g. a log file, one at a time.
+// It is used like bufio.Scanner:
+//
+//	scanner := registry.NewScanner(rd)
+//	for scanner.Scan() {
+//		m := scanner.Match()
+//	}
+//	if err := scanner.Err(); err != nil {
+//		...
+//	}
+//
+// IDs never span lines, so the stream is read a line at a time and lines
+// may be of any length.
+type Scanner struct {
+	registry *Registry
+	re       *regexp.Regexp
+	rd       *bufio.Reader
+	offset   int64
+	pending  []Match
+	match    Match
+	err      error
+	done     bool
+}
+
+// NewScanner returns a Scanner reading the IDs FindAll would find in rd.
+func (r *Registry) NewScanner(rd io.Reader) *Scanner {
+	return &Scanner{registry: r, re: r.idRegexp(), rd: bufio.NewReader(rd)}
+}
+
+// Scan advances to the next ID, which is then available through Match. It
+// returns false at the end of the stream or on a read error.
+func (s *Scanner) Scan() bool {
+	for len(s.pending) == 0 {
+		if s.done {
+			return false
+		}
+		line, err := s.rd.ReadString('\n')
+		s.pending = s.registry.findAll(s.re, line, s.offset)
+		s.offset += int64(len(line))
+		if err != nil {
+			s.done = true
+			if !errors.Is(err, io.EOF) {
+				s.err = err
+			}
+		}
+	}
+	s.match, s.pending = s.pending[0], s.pending[1:]
+	return true
+}
+
+// Match returns the ID found by the last call to Scan.
+func (s *Scanner) Match() Match {
+	return s.match
+}
+
+// Err returns the first non-EOF error encountered while reading.
+func (s *Scanner) Err() error {
+	return s.err
+}
@@ -0,0 +1,96 @@
+package prefixed_uuids
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func matchIDs(matches []Match) []string {
+	var ids []string
+	for _, m := range matches {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+func TestFindAll(t *testing.T) {
+	u := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+	v := uuid.MustParse("0195e37c-1a2b-7c3d-8e4f-5a6b7c8d9e0f")
+	user := prefixer.Serialize(User, u)
+	userV2 := prefixer.Serialize(UserV2, v)
+	up, err := prefixer.SerializeMulti(UserPost, EntityUUID{User, u}, EntityUUID{Post, v})
+	assert.NoError(t, err)
+
+	line := `level=info user=` + user + ` msg="moved ` + up + ` to ` + userV2 + `," path=/users/user.profile id=x` + user + ` sid.` + strings.Repeat("A", 22)
+	matches := prefixer.FindAll(line)
+	assert.Equal(t, []string{user, up, userV2, "sid." + strings.Repeat("A", 22)}, matchIDs(matches))
+
+	assert.Equal(t, Match{int64(strings.Index(line, user)), user, User, []EntityUUID{{User, u}}}, matches[0])
+	assert.Equal(t, Match{int64(strings.Index(line, up)), up, UserPost, []EntityUUID{{User, u}, {Post, v}}}, matches[1])
+	// IDs followed by punctuation are found too.
+	assert.Equal(t, UserV2, matches[2].Entity)
+	assert.Equal(t, line[matches[2].Offset:matches[2].Offset+int64(len(userV2))], userV2)
+
+	assert.Empty(t, prefixer.FindAll("no ids here, user.AZXje_k_dRiprKK-aEY8fgX nor "+user[1:]))
+	assert.Empty(t, prefixer.FindAll(""))
+}
+
+func TestFindAllRegistryOptions(t *testing.T) {
+	u := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+
+	// Separators which appear in payloads and prefixes.
+	r := mustRegistry(t, []PrefixInfo{{User, "user"}, {UserV2, "user_v2"}}, nil)
+	r, err := r.WithSeparator("_")
+	assert.NoError(t, err)
+	line := "a=" + r.Serialize(UserV2, u) + " b=" + r.Serialize(User, u)
+	assert.Equal(t, []string{r.Serialize(UserV2, u), r.Serialize(User, u)}, matchIDs(r.FindAll(line)))
+
+	// Secret tokens, tenant scoped IDs and IDs of other environments are
+	// skipped.
+	r = newSecretRegistry(t)
+	r, err = r.WithLists(ListPrefixInfo{PostSelection, "users", User, 1, 3})
+	assert.NoError(t, err)
+	secret, err := r.GenerateSecret(SecretKey)
+	assert.NoError(t, err)
+	list, err := r.SerializeMulti(PostSelection, EntityUUID{User, u}, EntityUUID{User, u})
+	assert.NoError(t, err)
+	line = secret.Reveal() + " sk_test.AZXje_k_dRiprKK-aEY8fg " + list
+	assert.Equal(t, []string{list}, matchIDs(r.FindAll(line)))
+
+	typeID, err := mustRegistry(t, []PrefixInfo{{User, "user"}}, nil).WithTypeID()
+	assert.NoError(t, err)
+	id := typeID.Serialize(User, u)
+	assert.Equal(t, []string{id}, matchIDs(typeID.FindAll("created "+id+".")))
+}
+
+func TestScanner(t *testing.T) {
+	u := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+	user := prefixer.Serialize(User, u)
+	post := prefixer.Serialize(Post, u)
+	input := "start\n" + user + " " + post + "\n\nno ids\n" + strings.Repeat("x", 100_000) + " " + user
+
+	scanner := prefixer.NewScanner(strings.NewReader(input))
+	var matches []Match
+	for scanner.Scan() {
+		matches = append(matches, scanner.Match())
+	}
+	assert.NoError(t, scanner.Err())
+	assert.Equal(t, []string{user, post, user}, matchIDs(matches))
+	assert.Equal(t, []int64{6, int64(6 + len(user) + 1), int64(len(input) - len(user))},
+		[]int64{matches[0].Offset, matches[1].Offset, matches[2].Offset})
+	assert.Equal(t, prefixer.FindAll(input), matches)
+
+	readErr := errors.New("read failed")
+	scanner = prefixer.NewScanner(io.MultiReader(strings.NewReader(user+"\n"), iotest.ErrReader(readErr)))
+	assert.True(t, scanner.Scan())
+	assert.Equal(t, user, scanner.Match().ID)
+	assert.False(t, scanner.Scan())
+	assert.ErrorIs(t, scanner.Err(), readErr)
+	assert.False(t, scanner.Scan())
+}
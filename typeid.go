@@ -0,0 +1,144 @@
+package prefixed_uuids
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// TypeID support, see https://github.com/jetify-com/typeid/tree/main/spec.
+// A TypeID is a lowercase prefix, an underscore and the 128 bits of a UUID
+// encoded as 26 characters of lowercase Crockford base32.
+
+const (
+	typeIDSeparator    = "_"
+	typeIDSuffixLength = 26
+	typeIDAlphabet     = "0123456789abcdefghjkmnpqrstvwxyz"
+)
+
+var (
+	typeIDPrefixRegex = regexp.MustCompile(`^[a-z]([a-z_]{0,61}[a-z])?$`)
+	typeIDDecoding    [256]byte
+)
+
+func init() {
+	for i := range typeIDDecoding {
+		typeIDDecoding[i] = 0xFF
+	}
+	for i := 0; i < len(typeIDAlphabet); i++ {
+		typeIDDecoding[typeIDAlphabet[i]] = byte(i)
+	}
+}
+
+// WithTypeID switches the registry to the TypeID format: IDs are written
+// and read as "prefix_<26 char base32 suffix>", exactly as specified by the
+// TypeID spec, so they interoperate with TypeID libraries in other
+// languages. All registered prefixes must be valid TypeID prefixes, and
+// multi types are not supported since TypeIDs hold a single UUID.
+func (r *Registry) WithTypeID() (*Registry, error) {
+	for prefix := range r.reverse {
+		if !typeIDPrefixRegex.MatchString(prefix) {
+			return nil, fmt.Errorf("prefix %q is not a valid typeid prefix, it must contain only lowercase letters and underscores, start and end with a letter and be at most 63 characters", prefix)
+		}
+	}
+	if len(r.multi) > 0 || len(r.lists) > 0 {
+		return nil, fmt.Errorf("multi types are not supported by typeid registries")
+	}
+	if len(r.unions) > 0 {
+		return nil, fmt.Errorf("unions are not supported by typeid registries")
+	}
+	if len(r.tenantScoped) > 0 {
+		return nil, fmt.Errorf("tenant scoped entities are not supported by typeid registries")
+	}
+	if len(r.secrets) > 0 {
+		return nil, fmt.Errorf("secret entities are not supported by typeid registries")
+	}
+	r.separator = typeIDSeparator
+	r.encoding = EncodingTypeID
+	return r, nil
+}
+
+// FormatTypeID formats a TypeID from a prefix and a UUID. The prefix may be
+// empty, in which case the TypeID is just the suffix.
+func FormatTypeID(prefix string, id uuid.UUID) (string, error) {
+	if prefix != "" && !typeIDPrefixRegex.MatchString(prefix) {
+		return "", fmt.Errorf("%w: invalid typeid prefix %q", ErrInvalidPrefixedUUIDFormat, prefix)
+	}
+	suffix := encodeTypeIDSuffix(id[:])
+	if prefix == "" {
+		return suffix, nil
+	}
+	return prefix + typeIDSeparator + suffix, nil
+}
+
+// ParseTypeID parses a TypeID into its prefix and UUID.
+func ParseTypeID(s string) (string, uuid.UUID, error) {
+	prefix, suffix, err := splitTypeID(s)
+	if err != nil {
+		return "", uuid.Nil, err
+	}
+	payload, err := decodeTypeIDSuffix(suffix)
+	if err != nil {
+		return "", uuid.Nil, err
+	}
+	return prefix, uuid.UUID(payload), nil
+}
+
+// splitTypeID splits a TypeID at its last underscore and validates the
+// prefix. The suffix is validated when it is decoded.
+func splitTypeID(s string) (string, string, error) {
+	at := strings.LastIndex(s, typeIDSeparator)
+	if at < 0 {
+		return "", s, nil
+	}
+	prefix := s[:at]
+	if !typeIDPrefixRegex.MatchString(prefix) {
+		return "", "", fmt.Errorf("%w: invalid typeid prefix %q", ErrInvalidPrefixedUUIDFormat, prefix)
+	}
+	return prefix, s[at+1:], nil
+}
+
+// encodeTypeIDSuffix encodes 16 bytes as 26 base32 characters. The 128 bits
+// are left-padded with two zero bits to make up 130 bits.
+func encodeTypeIDSuffix(payload []byte) string {
+	var out [typeIDSuffixLength]byte
+	for i := range out {
+		var v byte
+		for b := 0; b < 5; b++ {
+			v <<= 1
+			if bit := i*5 + b - 2; bit >= 0 {
+				v |= (payload[bit/8] >> (7 - bit%8)) & 1
+			}
+		}
+		out[i] = typeIDAlphabet[v]
+	}
+	return string(out[:])
+}
+
+// decodeTypeIDSuffix decodes a 26 character base32 suffix into 16 bytes.
+// Uppercase characters are rejected, as is a first character above '7'
+// since it would overflow 128 bits.
+func decodeTypeIDSuffix(suffix string) ([]byte, error) {
+	if len(suffix) != typeIDSuffixLength {
+		return nil, fmt.Errorf("%w: typeid suffix must be %d characters", ErrInvalidUUIDFormat, typeIDSuffixLength)
+	}
+	payload := make([]byte, 16)
+	for i := 0; i < len(suffix); i++ {
+		v := typeIDDecoding[suffix[i]]
+		if v == 0xFF {
+			return nil, fmt.Errorf("%w: invalid typeid suffix character %q", ErrInvalidUUIDFormat, suffix[i])
+		}
+		if i == 0 && v > 7 {
+			return nil, fmt.Errorf("%w: typeid suffix overflows 128 bits", ErrInvalidUUIDFormat)
+		}
+		for b := 0; b < 5; b++ {
+			bit := i*5 + b - 2
+			if bit >= 0 && (v>>(4-b))&1 == 1 {
+				payload[bit/8] |= 1 << (7 - bit%8)
+			}
+		}
+	}
+	return payload, nil
+}
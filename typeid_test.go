@@ -0,0 +1,144 @@
+package prefixed_uuids
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// typeIDVectors mirrors the valid and invalid test cases of the TypeID spec.
+type typeIDVectors struct {
+	Valid []struct {
+		Name   string `json:"name"`
+		TypeID string `json:"typeid"`
+		Prefix string `json:"prefix"`
+		UUID   string `json:"uuid"`
+	} `json:"valid"`
+	Invalid []struct {
+		Name        string `json:"name"`
+		TypeID      string `json:"typeid"`
+		Description string `json:"description"`
+	} `json:"invalid"`
+}
+
+func loadTypeIDVectors(t *testing.T) typeIDVectors {
+	t.Helper()
+	data, err := os.ReadFile("testdata/typeid.json")
+	assert.NoError(t, err)
+	var vectors typeIDVectors
+	assert.NoError(t, json.Unmarshal(data, &vectors))
+	return vectors
+}
+
+func TestTypeIDSpecValid(t *testing.T) {
+	for _, v := range loadTypeIDVectors(t).Valid {
+		t.Run(v.Name, func(t *testing.T) {
+			expected := uuid.MustParse(v.UUID)
+
+			prefix, parsed, err := ParseTypeID(v.TypeID)
+			assert.NoError(t, err)
+			assert.Equal(t, v.Prefix, prefix)
+			assert.Equal(t, expected, parsed)
+
+			formatted, err := FormatTypeID(v.Prefix, expected)
+			assert.NoError(t, err)
+			assert.Equal(t, v.TypeID, formatted)
+
+			if v.Prefix == "" {
+				return
+			}
+			r, err := mustRegistry(t, []PrefixInfo{{User, v.Prefix}}, nil).WithTypeID()
+			assert.NoError(t, err)
+			assert.Equal(t, v.TypeID, r.Serialize(User, expected))
+			parsed, err = r.Deserialize(User, v.TypeID)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, parsed)
+		})
+	}
+}
+
+func TestTypeIDSpecInvalid(t *testing.T) {
+	r, err := mustRegistry(t, []PrefixInfo{{User, "prefix"}}, nil).WithTypeID()
+	assert.NoError(t, err)
+
+	for _, v := range loadTypeIDVectors(t).Invalid {
+		t.Run(v.Name, func(t *testing.T) {
+			_, _, err := ParseTypeID(v.TypeID)
+			assert.Error(t, err, v.Description)
+
+			_, _, err = r.DeserializeWithEntity(v.TypeID)
+			assert.Error(t, err, v.Description)
+		})
+	}
+}
+
+func TestTypeIDRegistry(t *testing.T) {
+	r, err := mustRegistry(t, []PrefixInfo{{User, "user"}, {Post, "post"}}, nil).WithTypeID()
+	assert.NoError(t, err)
+	assert.Equal(t, EncodingTypeID, r.Definition().Encoding)
+	assert.Equal(t, "_", r.Definition().Separator)
+
+	u := uuid.MustParse("01890a5d-ac96-774b-bcce-b302099a8057")
+	assert.Equal(t, "user_01h455vb4pex5vsknk084sn02q", r.Serialize(User, u))
+
+	entity, parsed, err := r.DeserializeWithEntity("post_01h455vb4pex5vsknk084sn02q")
+	assert.NoError(t, err)
+	assert.Equal(t, Post, entity)
+	assert.Equal(t, u, parsed)
+
+	_, err = r.Deserialize(Post, "user_01h455vb4pex5vsknk084sn02q")
+	assert.ErrorIs(t, err, ErrEntityMismatch)
+	_, _, err = r.DeserializeWithEntity("comment_01h455vb4pex5vsknk084sn02q")
+	assert.ErrorIs(t, err, ErrUnknownPrefix)
+	_, _, err = r.DeserializeWithEntity("01h455vb4pex5vsknk084sn02q")
+	assert.ErrorIs(t, err, ErrUnknownPrefix)
+	_, _, err = r.DeserializeWithEntity("user_01H455VB4PEX5VSKNK084SN02Q")
+	assert.ErrorIs(t, err, ErrInvalidUUIDFormat)
+	_, _, err = r.DeserializeWithEntity("User_01h455vb4pex5vsknk084sn02q")
+	assert.ErrorIs(t, err, ErrInvalidPrefixedUUIDFormat)
+
+	_, err = r.WithSeparator(".")
+	assert.ErrorIs(t, err, ErrInvalidSeparator)
+	_, err = r.WithSeparator("_")
+	assert.NoError(t, err)
+}
+
+func TestTypeIDRegistryValidation(t *testing.T) {
+	// Digits and hyphens are valid registry prefixes but not typeid prefixes.
+	for _, prefix := range []string{"user_v2", "user-v2", "_user", "user_"} {
+		_, err := mustRegistry(t, []PrefixInfo{{User, prefix}}, nil).WithTypeID()
+		assert.Error(t, err, prefix)
+	}
+
+	_, err := mustRegistry(t, []PrefixInfo{{User, "user_post"}}, nil).WithTypeID()
+	assert.NoError(t, err)
+
+	_, err = mustRegistry(t,
+		[]PrefixInfo{{User, "user"}, {Post, "post"}},
+		[]MultiPrefixInfo{{UserPost, "up", []Entity{User, Post}}},
+	).WithTypeID()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "multi types are not supported")
+
+	// Multi types and unions can't be added afterwards either, since typeid
+	// payloads hold a single UUID.
+	typeID, err := mustRegistry(t, []PrefixInfo{{User, "user"}, {Post, "post"}}, nil).WithTypeID()
+	assert.NoError(t, err)
+	_, err = typeID.WithMulti(MultiPrefixInfo{UserPost, "up", []Entity{User, Post}})
+	assert.ErrorContains(t, err, "multi types are not supported by typeid registries")
+	_, err = typeID.WithUnions(UnionInfo{Commentable, []Entity{User, Post}})
+	assert.ErrorContains(t, err, "unions are not supported by typeid registries")
+	_, err = typeID.SerializeMulti(UserPost, EntityUUID{User, uuid.Nil}, EntityUUID{Post, uuid.Nil})
+	assert.ErrorIs(t, err, ErrNotMultiEntity)
+
+	unions, err := mustRegistry(t, []PrefixInfo{{User, "user"}, {Post, "post"}}, nil).WithUnions(UnionInfo{Commentable, []Entity{User, Post}})
+	assert.NoError(t, err)
+	_, err = unions.WithTypeID()
+	assert.ErrorContains(t, err, "unions are not supported by typeid registries")
+
+	_, err = FormatTypeID("Prefix", uuid.Nil)
+	assert.ErrorIs(t, err, ErrInvalidPrefixedUUIDFormat)
+}
@@ -0,0 +1,205 @@
+package prefixed_uuids
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+// maxUnionEntities is the number of entities a union can hold, since the
+// entity stored in a union component is tagged with a single byte.
+const maxUnionEntities = 256
+
+// UnionInfo describes a union: a named set of entities, e.g. everything
+// that can be commented on. A union has no prefix of its own, but can be
+// used as a multi type component which accepts any of its entities, and
+// with DeserializeOneOf to accept IDs of any of its entities.
+type UnionInfo struct {
+	Entity   Entity   `json:"entity"`
+	Entities []Entity `json:"entities"`
+}
+
+// WithUnions registers unions. Multi types using them as components must
+// be registered afterwards with WithMulti.
+//
+// A union component is stored as a one byte tag, the index of the entity
+// in Entities, followed by the UUID. Entities can therefore be appended to
+// a union later, but not removed or reordered.
+func (r *Registry) WithUnions(unions ...UnionInfo) (*Registry, error) {
+	if r.encoding == EncodingTypeID {
+		return nil, fmt.Errorf("unions are not supported by typeid registries")
+	}
+	added := make([]Entity, 0, len(unions))
+	rollback := func() {
+		for _, entity := range added {
+			delete(r.unions, entity)
+		}
+	}
+
+	for _, info := range unions {
+		if err := r.checkUnion(info); err != nil {
+			rollback()
+			return nil, err
+		}
+		r.unions[info.Entity] = info.Entities
+		added = append(added, info.Entity)
+	}
+	return r, nil
+}
+
+func (r *Registry) checkUnion(info UnionInfo) error {
+	if err := checkEntity(info.Entity); err != nil {
+		return err
+	}
+	_, registered := r.prefixes[info.Entity]
+	if _, union := r.unions[info.Entity]; registered || union {
+		return fmt.Errorf("entity %d is already registered", info.Entity)
+	}
+	if len(info.Entities) < 2 || len(info.Entities) > maxUnionEntities {
+		return fmt.Errorf("union must have between 2 and %d entities", maxUnionEntities)
+	}
+	for i, e := range info.Entities {
+		if _, ok := r.prefixes[e]; !ok || r.isComposite(e) {
+			return fmt.Errorf("union entity %d is not registered in the registry", e)
+		}
+		if err := r.checkPlainComponent(e); err != nil {
+			return err
+		}
+		if slices.Contains(info.Entities[:i], e) {
+			return fmt.Errorf("union entity %d is listed more than once", e)
+		}
+	}
+	return nil
+}
+
+// WithMulti registers multi types like NewRegistry2. It is needed for
+// multi types with union components, since unions are registered after
+// the registry is created.
+func (r *Registry) WithMulti(multiPrefixes ...MultiPrefixInfo) (*Registry, error) {
+	added := make([]MultiPrefixInfo, 0, len(multiPrefixes))
+	rollback := func() {
+		for _, info := range added {
+			delete(r.prefixes, info.Entity)
+			delete(r.reverse, info.Prefix)
+			delete(r.multi, info.Entity)
+		}
+	}
+
+	for _, info := range multiPrefixes {
+		if err := r.addMulti(info); err != nil {
+			rollback()
+			return nil, err
+		}
+		added = append(added, info)
+	}
+
+	if isPayloadChar(r.separator) {
+		if err := r.checkFixedLengthAmbiguity(r.separator); err != nil {
+			rollback()
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// members returns the entities accepted by a multi type component.
+func (r *Registry) members(component Entity) []Entity {
+	entity, _ := splitOptional(component)
+	if members, ok := r.unions[entity]; ok {
+		return members
+	}
+	return []Entity{entity}
+}
+
+// accepts reports whether the multi type component holds entity.
+func (r *Registry) accepts(component, entity Entity) bool {
+	return slices.Contains(r.members(component), entity)
+}
+
+// componentSize returns the payload size in bytes of a multi type
+// component.
+func (r *Registry) componentSize(component Entity) int {
+	entity, _ := splitOptional(component)
+	if _, ok := r.unions[entity]; ok {
+		return 17
+	}
+	return 16
+}
+
+// appendComponent appends the payload of pair as the multi type component
+// to buf. It returns false if the component does not accept the pair's
+// entity.
+func (r *Registry) appendComponent(buf []byte, component Entity, pair EntityUUID) ([]byte, bool) {
+	entity, _ := splitOptional(component)
+	if members, ok := r.unions[entity]; ok {
+		tag := slices.Index(members, pair.Entity)
+		if tag < 0 {
+			return buf, false
+		}
+		buf = append(buf, byte(tag))
+	} else if pair.Entity != entity {
+		return buf, false
+	}
+	uuidBytes, _ := pair.UUID.MarshalBinary()
+	return append(buf, uuidBytes...), true
+}
+
+// readComponent reads a multi type component from the start of payload and
+// returns the rest of the payload.
+func (r *Registry) readComponent(component Entity, payload []byte) (EntityUUID, []byte, error) {
+	entity, _ := splitOptional(component)
+	if members, ok := r.unions[entity]; ok {
+		if len(payload) == 0 {
+			return EntityUUID{}, nil, fmt.Errorf("%w", ErrInvalidUUIDFormat)
+		}
+		tag := int(payload[0])
+		if tag >= len(members) {
+			return EntityUUID{}, nil, fmt.Errorf("%w: unknown union tag %d", ErrInvalidUUIDFormat, tag)
+		}
+		entity, payload = members[tag], payload[1:]
+	}
+	if len(payload) < 16 {
+		return EntityUUID{}, nil, fmt.Errorf("%w", ErrInvalidUUIDFormat)
+	}
+	parsed, err := uuid.FromBytes(payload[:16])
+	if err != nil {
+		return EntityUUID{}, nil, errors.Join(err, ErrInvalidUUIDFormat)
+	}
+	return EntityUUID{entity, parsed}, payload[16:], nil
+}
+
+// DeserializeMultiEntities deserializes a multi or list type into the pairs
+// it was serialized from, reporting the entity actually stored in each
+// union component. Absent optional components are left out.
+func (r *Registry) DeserializeMultiEntities(entity Entity, uuidStr string) ([]EntityUUID, error) {
+	parsedEntity, payload, err := r.decodePayload(uuidStr)
+	if err != nil {
+		return nil, err
+	}
+	if parsedEntity != entity {
+		return nil, fmt.Errorf("%w", ErrEntityMismatch)
+	}
+
+	n := len(r.flatComponents(entity))
+	if _, ok := r.lists[entity]; ok {
+		n = len(payload) / 16
+	}
+	components, err := r.components(entity, n)
+	if err != nil {
+		return nil, err
+	}
+	values, err := r.decodeComponents(entity, components, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	pairs := make([]EntityUUID, 0, len(values))
+	for _, v := range values {
+		if v.Entity != NullEntity {
+			pairs = append(pairs, v)
+		}
+	}
+	return pairs, nil
+}
@@ -0,0 +1,154 @@
+package prefixed_uuids
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	Commentable    Entity = 30
+	UserCommentRef Entity = 31
+	Photo          Entity = 32
+	MaybeContent   Entity = 33
+)
+
+func newUnionRegistry(t *testing.T) *Registry {
+	t.Helper()
+	r := mustRegistry(t, []PrefixInfo{{User, "user"}, {Post, "post"}, {Photo, "photo"}}, nil)
+	r, err := r.WithUnions(UnionInfo{Commentable, []Entity{Post, Photo}})
+	assert.NoError(t, err)
+	r, err = r.WithMulti(
+		MultiPrefixInfo{UserCommentRef, "ucr", []Entity{User, Commentable}},
+		MultiPrefixInfo{MaybeContent, "uc", []Entity{User, Optional(Commentable)}},
+	)
+	assert.NoError(t, err)
+	return r
+}
+
+func TestUnionRoundTrip(t *testing.T) {
+	r := newUnionRegistry(t)
+	userID := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+	targetID := uuid.MustParse("0195e37c-1a2b-7c3d-8e4f-5a6b7c8d9e0f")
+
+	for _, target := range []Entity{Post, Photo} {
+		encoded, err := r.SerializeMulti(UserCommentRef, EntityUUID{User, userID}, EntityUUID{target, targetID})
+		assert.NoError(t, err)
+		// The union component takes a one byte tag in addition to the UUID.
+		assert.Len(t, encoded, len("ucr.")+base64withNoPadding.EncodedLen(16+17))
+
+		pairs, err := r.DeserializeMultiEntities(UserCommentRef, encoded)
+		assert.NoError(t, err)
+		assert.Equal(t, []EntityUUID{{User, userID}, {target, targetID}}, pairs)
+
+		// Targets can use the union entity to accept either entity.
+		var user, ref uuid.UUID
+		err = r.DeserializeMulti(UserCommentRef, encoded, EntityUUIDPtr{User, &user}, EntityUUIDPtr{Commentable, &ref})
+		assert.NoError(t, err)
+		assert.Equal(t, targetID, ref)
+
+		// Or a specific entity, which must match the stored one.
+		err = r.DeserializeMulti(UserCommentRef, encoded, EntityUUIDPtr{User, &user}, EntityUUIDPtr{Post, &ref})
+		if target == Post {
+			assert.NoError(t, err)
+		} else {
+			assert.ErrorIs(t, err, ErrEntityMismatch)
+		}
+	}
+}
+
+func TestUnionOptional(t *testing.T) {
+	r := newUnionRegistry(t)
+	u := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+
+	for _, pairs := range [][]EntityUUID{
+		{{User, u}},
+		{{User, u}, {Post, u}},
+		{{User, u}, {Photo, u}},
+	} {
+		encoded, err := r.SerializeMulti(MaybeContent, pairs...)
+		assert.NoError(t, err)
+		parsed, err := r.DeserializeMultiEntities(MaybeContent, encoded)
+		assert.NoError(t, err)
+		assert.Equal(t, pairs, parsed)
+	}
+}
+
+func TestUnionErrors(t *testing.T) {
+	r := newUnionRegistry(t)
+	u := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+
+	_, err := r.SerializeMulti(UserCommentRef, EntityUUID{User, u}, EntityUUID{User, u})
+	assert.ErrorIs(t, err, ErrEntityOrderMismatch)
+	_, err = r.SerializeMulti(UserCommentRef, EntityUUID{User, u}, EntityUUID{Commentable, u})
+	assert.ErrorIs(t, err, ErrEntityOrderMismatch)
+
+	var user, ref uuid.UUID
+	encoded, err := r.SerializeMulti(UserCommentRef, EntityUUID{User, u}, EntityUUID{Post, u})
+	assert.NoError(t, err)
+	err = r.DeserializeMulti(UserCommentRef, encoded, EntityUUIDPtr{User, &user}, EntityUUIDPtr{User, &ref})
+	assert.ErrorIs(t, err, ErrEntityOrderMismatch)
+
+	// Tag 2 is not an entity of the union.
+	payload := make([]byte, 33)
+	payload[16] = 2
+	_, err = r.DeserializeMultiEntities(UserCommentRef, "ucr."+base64withNoPadding.EncodeToString(payload))
+	assert.ErrorIs(t, err, ErrInvalidUUIDFormat)
+	_, err = r.DeserializeMultiEntities(UserCommentRef, "ucr."+base64withNoPadding.EncodeToString(payload[:32]))
+	assert.ErrorIs(t, err, ErrInvalidUUIDFormat)
+}
+
+func TestWithUnionsValidation(t *testing.T) {
+	tests := []struct {
+		name          string
+		union         UnionInfo
+		expectedError string
+	}{
+		{"null entity", UnionInfo{NullEntity, []Entity{Post, Photo}}, "NullEntity"},
+		{"registered entity", UnionInfo{Post, []Entity{Post, Photo}}, "already registered"},
+		{"single entity", UnionInfo{Commentable, []Entity{Post}}, "between 2 and 256"},
+		{"unregistered entity", UnionInfo{Commentable, []Entity{Post, Comment}}, "not registered"},
+		{"multi entity", UnionInfo{Commentable, []Entity{Post, UserPost}}, "not registered"},
+		{"duplicate entity", UnionInfo{Commentable, []Entity{Post, Photo, Post}}, "more than once"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := mustRegistry(t,
+				[]PrefixInfo{{User, "user"}, {Post, "post"}, {Photo, "photo"}},
+				[]MultiPrefixInfo{{UserPost, "up", []Entity{User, Post}}},
+			)
+			_, err := r.WithUnions(UnionInfo{Other, []Entity{User, Post}}, tt.union)
+			assert.ErrorContains(t, err, tt.expectedError)
+			// Nothing is registered when any union is invalid.
+			_, ok := r.unions[Other]
+			assert.False(t, ok)
+		})
+	}
+
+	r := newUnionRegistry(t)
+	_, err := r.WithMulti(MultiPrefixInfo{Other, "other", []Entity{Optional(Commentable), Post}})
+	assert.ErrorContains(t, err, "ambiguous")
+	_, err = r.WithMulti(MultiPrefixInfo{Other, "other", []Entity{User, Comment}})
+	assert.ErrorContains(t, err, "not registered")
+	_, ok := r.reverse["other"]
+	assert.False(t, ok)
+}
+
+func TestUnionDefinition(t *testing.T) {
+	def := newUnionRegistry(t).Definition()
+	assert.Equal(t, []UnionInfo{{Commentable, []Entity{Post, Photo}}}, def.Unions)
+	assert.Contains(t, string(def.Canonical()), "union 30 2 32\n")
+
+	extended := def
+	extended.Unions = []UnionInfo{{Commentable, []Entity{Post, Photo, User}}}
+	assert.Equal(t, []string{
+		"safe: union 30 entities extended from [2 32] to [2 32 1]",
+	}, changeMessages(CheckCompatibility(def, extended)))
+
+	reordered := def
+	reordered.Unions = []UnionInfo{{Commentable, []Entity{Photo, Post}}}
+	assert.Equal(t, []string{
+		"breaking: union 30 entities changed from [2 32] to [32 2]",
+	}, changeMessages(CheckCompatibility(def, reordered)))
+}
@@ -0,0 +1,82 @@
+package prefixed_uuids
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const urnScheme = "urn"
+
+// urnNIDRegex matches a namespace identifier as defined by RFC 8141:
+// 2 to 32 alphanumerics and hyphens, not starting or ending with a hyphen.
+var urnNIDRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9-]{0,30}[a-zA-Z0-9]$`)
+
+// WithURNNamespace sets the namespace identifier (NID) used to render IDs as
+// RFC 8141 URNs of the form "urn:<nid>:<prefix>:<payload>". The NID is
+// compared case-insensitively when parsing, as required by the RFC.
+func (r *Registry) WithURNNamespace(nid string) (*Registry, error) {
+	if !urnNIDRegex.MatchString(nid) || strings.EqualFold(nid, urnScheme) {
+		return nil, fmt.Errorf("%w: invalid namespace identifier %q", ErrInvalidURN, nid)
+	}
+	r.urnNamespace = nid
+	return r, nil
+}
+
+// SerializeURN is like Serialize but returns the URN form of the ID.
+func (r *Registry) SerializeURN(entity Entity, uuid uuid.UUID) (string, error) {
+	return r.ToURN(r.Serialize(entity, uuid))
+}
+
+// SerializeMultiURN is like SerializeMulti but returns the URN form of the ID.
+func (r *Registry) SerializeMultiURN(entity Entity, pairs ...EntityUUID) (string, error) {
+	id, err := r.SerializeMulti(entity, pairs...)
+	if err != nil {
+		return "", err
+	}
+	return r.ToURN(id)
+}
+
+// DeserializeURN parses the URN form of an ID of the given entity.
+func (r *Registry) DeserializeURN(entity Entity, urn string) (uuid.UUID, error) {
+	id, err := r.FromURN(urn)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return r.Deserialize(entity, id)
+}
+
+// ToURN converts a prefixed ID in the standard "prefix.payload" form to its
+// URN form. Both single and multi IDs are supported.
+func (r *Registry) ToURN(id string) (string, error) {
+	if r.urnNamespace == "" {
+		return "", fmt.Errorf("%w", ErrURNNamespaceNotSet)
+	}
+	if _, _, err := r.decodePayload(id); err != nil {
+		return "", err
+	}
+	// decodePayload has already validated the ID.
+	prefix, payload, _ := r.splitID(id)
+	return strings.Join([]string{urnScheme, r.urnNamespace, prefix, payload}, ":"), nil
+}
+
+// FromURN converts the URN form of an ID back to the standard
+// "prefix.payload" form.
+func (r *Registry) FromURN(urn string) (string, error) {
+	if r.urnNamespace == "" {
+		return "", fmt.Errorf("%w", ErrURNNamespaceNotSet)
+	}
+	parts := strings.Split(urn, ":")
+	if len(parts) != 4 || !strings.EqualFold(parts[0], urnScheme) || parts[2] == "" || parts[3] == "" {
+		return "", fmt.Errorf("%w", ErrInvalidURN)
+	}
+	if !strings.EqualFold(parts[1], r.urnNamespace) {
+		return "", fmt.Errorf("%w: unexpected namespace %q", ErrInvalidURN, parts[1])
+	}
+	if _, ok := r.reverse[parts[2]]; !ok {
+		return "", fmt.Errorf("%w", ErrUnknownPrefix)
+	}
+	return parts[2] + r.separator + parts[3], nil
+}
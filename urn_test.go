@@ -0,0 +1,118 @@
+package prefixed_uuids
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func newURNRegistry(t *testing.T) *Registry {
+	t.Helper()
+	r := mustRegistry(t,
+		[]PrefixInfo{{User, "user"}, {Post, "post"}},
+		[]MultiPrefixInfo{{UserPost, "up", []Entity{User, Post}}},
+	)
+	r, err := r.WithURNNamespace("example")
+	assert.NoError(t, err)
+	return r
+}
+
+func TestURNRoundTrip(t *testing.T) {
+	r := newURNRegistry(t)
+	u := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+
+	urn, err := r.SerializeURN(User, u)
+	assert.NoError(t, err)
+	assert.Equal(t, "urn:example:user:AZXje_k_dRiprKK-aEY8fg", urn)
+
+	parsed, err := r.DeserializeURN(User, urn)
+	assert.NoError(t, err)
+	assert.Equal(t, u, parsed)
+
+	// The scheme and NID are case-insensitive.
+	parsed, err = r.DeserializeURN(User, "URN:Example:user:AZXje_k_dRiprKK-aEY8fg")
+	assert.NoError(t, err)
+	assert.Equal(t, u, parsed)
+
+	id, err := r.FromURN(urn)
+	assert.NoError(t, err)
+	assert.Equal(t, r.Serialize(User, u), id)
+
+	back, err := r.ToURN(id)
+	assert.NoError(t, err)
+	assert.Equal(t, urn, back)
+
+	_, err = r.DeserializeURN(Post, urn)
+	assert.ErrorIs(t, err, ErrEntityMismatch)
+}
+
+func TestURNMulti(t *testing.T) {
+	r := newURNRegistry(t)
+	userUUID := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7e")
+	postUUID := uuid.MustParse("0195e37b-f93f-7518-a9ac-a2be68463c7f")
+
+	urn, err := r.SerializeMultiURN(UserPost, EntityUUID{User, userUUID}, EntityUUID{Post, postUUID})
+	assert.NoError(t, err)
+	assert.Equal(t, "urn:example:up:AZXje_k_dRiprKK-aEY8fgGV43v5P3UYqayivmhGPH8", urn)
+
+	id, err := r.FromURN(urn)
+	assert.NoError(t, err)
+	var parsedUser, parsedPost uuid.UUID
+	err = r.DeserializeMulti(UserPost, id, EntityUUIDPtr{User, &parsedUser}, EntityUUIDPtr{Post, &parsedPost})
+	assert.NoError(t, err)
+	assert.Equal(t, userUUID, parsedUser)
+	assert.Equal(t, postUUID, parsedPost)
+
+	_, err = r.SerializeMultiURN(UserPost, EntityUUID{User, userUUID})
+	assert.ErrorIs(t, err, ErrUUIDCountMismatch)
+}
+
+func TestURNWithCustomSeparator(t *testing.T) {
+	r := newURNRegistry(t)
+	r, err := r.WithSeparator("~")
+	assert.NoError(t, err)
+
+	id, err := r.FromURN("urn:example:user:AZXje_k_dRiprKK-aEY8fg")
+	assert.NoError(t, err)
+	assert.Equal(t, "user~AZXje_k_dRiprKK-aEY8fg", id)
+}
+
+func TestURNErrors(t *testing.T) {
+	r := newURNRegistry(t)
+
+	for _, nid := range []string{"", "a", "-abc", "abc-", "ex ample", "urn", "abcdefghijklmnopqrstuvwxyz0123456789"} {
+		_, err := mustRegistry(t, []PrefixInfo{{User, "user"}}, nil).WithURNNamespace(nid)
+		assert.ErrorIs(t, err, ErrInvalidURN, nid)
+	}
+
+	tests := []struct {
+		name          string
+		input         string
+		expectedError error
+	}{
+		{"empty", "", ErrInvalidURN},
+		{"wrong scheme", "urx:example:user:AZXje_k_dRiprKK-aEY8fg", ErrInvalidURN},
+		{"wrong namespace", "urn:other:user:AZXje_k_dRiprKK-aEY8fg", ErrInvalidURN},
+		{"missing payload", "urn:example:user", ErrInvalidURN},
+		{"empty payload", "urn:example:user:", ErrInvalidURN},
+		{"extra component", "urn:example:user:AZXje_k_dRiprKK-aEY8fg:x", ErrInvalidURN},
+		{"unknown prefix", "urn:example:zzz:AZXje_k_dRiprKK-aEY8fg", ErrUnknownPrefix},
+		{"bad base64", "urn:example:user:invalid-base64!", ErrInvalidUUIDBadBase64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := r.DeserializeURN(User, tt.input)
+			assert.ErrorIs(t, err, tt.expectedError)
+		})
+	}
+
+	_, err := r.ToURN("user.invalid-base64!")
+	assert.ErrorIs(t, err, ErrInvalidUUIDBadBase64)
+
+	plain := mustRegistry(t, []PrefixInfo{{User, "user"}}, nil)
+	_, err = plain.SerializeURN(User, uuid.New())
+	assert.ErrorIs(t, err, ErrURNNamespaceNotSet)
+	_, err = plain.FromURN("urn:example:user:AZXje_k_dRiprKK-aEY8fg")
+	assert.ErrorIs(t, err, ErrURNNamespaceNotSet)
+}